@@ -0,0 +1,288 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/parser"
+	"github.com/leaklessgfy/safran-server/utils"
+)
+
+// Config is the server configuration, read from a JSON file, then the environment, then the command line
+type Config struct {
+	Addr    string        `json:"addr"`
+	Influx  InfluxConfig  `json:"influx"`
+	Influx2 Influx2Config `json:"influx2"`
+	SQL     SQLConfig     `json:"sql"`
+	Output  OutputConfig  `json:"output"`
+	Imports ImportsConfig `json:"imports"`
+	Dates   DatesConfig   `json:"dates"`
+	Errors  ErrorsConfig  `json:"errors"`
+	Batch   BatchConfig   `json:"batch"`
+	// OutputBatch override the batch configuration per output key
+	OutputBatch map[string]BatchConfig `json:"outputBatch"`
+}
+
+// InfluxConfig is the configuration of the influx output
+type InfluxConfig struct {
+	URL       string      `json:"url"`
+	Database  string      `json:"database"`
+	Username  string      `json:"username"`
+	Password  string      `json:"password"`
+	Precision string      `json:"precision"`
+	Timeout   Duration    `json:"timeout"`
+	TLS       TLSConfig   `json:"tls"`
+	Retry     RetryConfig `json:"retry"`
+}
+
+// Influx2Config is the configuration of the influx 2.x output
+type Influx2Config struct {
+	URL       string      `json:"url"`
+	Org       string      `json:"org"`
+	Bucket    string      `json:"bucket"`
+	Token     string      `json:"token"`
+	Precision string      `json:"precision"`
+	Timeout   Duration    `json:"timeout"`
+	TLS       TLSConfig   `json:"tls"`
+	Retry     RetryConfig `json:"retry"`
+}
+
+// SQLConfig is the configuration of the sql output, the driver being sqlite3 or postgres,
+// sqlite having a single connection an import waits for the one running to end or be cancelled
+type SQLConfig struct {
+	Driver string `json:"driver"`
+	DSN    string `json:"dsn"`
+}
+
+// RetryConfig is how the failed requests are retried, the delay doubling after each attempt up to the max delay
+type RetryConfig struct {
+	Attempts int      `json:"attempts"`
+	Delay    Duration `json:"delay"`
+	MaxDelay Duration `json:"maxDelay"`
+}
+
+// TLSConfig is the configuration of a TLS connection
+type TLSConfig struct {
+	Insecure bool   `json:"insecure"`
+	CAFile   string `json:"caFile"`
+}
+
+// OutputConfig is the configuration of the file based outputs
+type OutputConfig struct {
+	Dir string `json:"dir"`
+}
+
+// ImportsConfig is the configuration of the imports registry
+type ImportsConfig struct {
+	TTL     Duration `json:"ttl"`
+	Max     int      `json:"max"`
+	Workers int      `json:"workers"`
+	Journal string   `json:"journal"`
+}
+
+// DatesConfig is the format of the dates in the samples header
+type DatesConfig struct {
+	Layouts  []string `json:"layouts"`
+	TimeZone string   `json:"timezone"`
+}
+
+// ErrorsConfig is how the malformed rows are handled, the policy being strict, skip or quarantine
+type ErrorsConfig struct {
+	Policy string `json:"policy"`
+	Max    int    `json:"max"`
+}
+
+// BatchConfig is how many lines are parsed at once and when the samples are saved,
+// the first of samples, bytes or interval reached triggering a save, every batch being saved when none is set
+type BatchConfig struct {
+	Lines    int      `json:"lines"`
+	Samples  int      `json:"samples"`
+	Bytes    int      `json:"bytes"`
+	Interval Duration `json:"interval"`
+}
+
+// Merge return the configuration overridden by the non zero values of o
+func (c BatchConfig) Merge(o BatchConfig) BatchConfig {
+	if o.Lines > 0 {
+		c.Lines = o.Lines
+	}
+	if o.Samples > 0 {
+		c.Samples = o.Samples
+	}
+	if o.Bytes > 0 {
+		c.Bytes = o.Bytes
+	}
+	if o.Interval.Duration > 0 {
+		c.Interval = o.Interval
+	}
+	return c
+}
+
+// BatchFor return the batch configuration of an output
+func (c Config) BatchFor(key string) BatchConfig {
+	return c.Batch.Merge(c.OutputBatch[key])
+}
+
+// Format return the date format described by the configuration
+func (c DatesConfig) Format() (utils.DateFormat, error) {
+	return utils.NewDateFormat(c.Layouts, c.TimeZone)
+}
+
+// Duration is a time.Duration read from a string like "10s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parse a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var str string
+	err := json.Unmarshal(b, &str)
+	if err != nil {
+		return errors.New("duration should be a string like \"10s\"")
+	}
+	d.Duration, err = time.ParseDuration(str)
+	return err
+}
+
+// MarshalJSON format the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default return the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Addr: ":8888",
+		Influx: InfluxConfig{
+			URL:       "http://localhost:8086",
+			Database:  "safran_db",
+			Precision: "ms",
+			Timeout:   Duration{30 * time.Second},
+			Retry: RetryConfig{
+				Attempts: 5,
+				Delay:    Duration{500 * time.Millisecond},
+				MaxDelay: Duration{10 * time.Second},
+			},
+		},
+		Influx2: Influx2Config{
+			URL:       "http://localhost:8086",
+			Bucket:    "safran",
+			Precision: "ms",
+			Timeout:   Duration{30 * time.Second},
+			Retry: RetryConfig{
+				Attempts: 5,
+				Delay:    Duration{500 * time.Millisecond},
+				MaxDelay: Duration{10 * time.Second},
+			},
+		},
+		SQL: SQLConfig{
+			Driver: "sqlite3",
+			DSN:    "./safran.db",
+		},
+		Output: OutputConfig{
+			Dir: "./results",
+		},
+		Imports: ImportsConfig{
+			TTL:     Duration{time.Hour},
+			Max:     10,
+			Journal: "./journals",
+		},
+		Dates: DatesConfig{
+			Layouts:  []string{utils.DefaultDateLayout},
+			TimeZone: "UTC",
+		},
+		Errors: ErrorsConfig{
+			Policy: string(parser.PolicyStrict),
+			Max:    100,
+		},
+		Batch: BatchConfig{
+			Lines: 500,
+		},
+		OutputBatch: map[string]BatchConfig{
+			"influx":       {Samples: 5000},
+			"influx2":      {Samples: 5000},
+			"lineprotocol": {Samples: 5000},
+			"parquet":      {Samples: 250000},
+			"sql":          {Samples: 5000},
+		},
+	}
+}
+
+// Load build the configuration from the command line args, the file they point to and the environment
+func Load(name string, args []string) (*Config, error) {
+	path := os.Getenv(envPrefix + "CONFIG")
+	err := newFlagSet(name, Default(), &path).Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := Default()
+	if path != "" {
+		err = loadFile(path, conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = loadEnv(conf)
+	if err != nil {
+		return nil, err
+	}
+	err = newFlagSet(name, conf, &path).Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conf.Dates.Format()
+	if err != nil {
+		return nil, errors.New("invalid dates config: " + err.Error())
+	}
+	_, err = parser.ParsePolicy(conf.Errors.Policy)
+	if err != nil {
+		return nil, errors.New("invalid errors config: " + err.Error())
+	}
+	if conf.Batch.Lines < 1 {
+		return nil, errors.New("invalid batch config: lines should be positive")
+	}
+	return conf, nil
+}
+
+func loadFile(path string, conf *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(conf)
+	if err != nil {
+		return errors.New("invalid config file " + path + ": " + err.Error())
+	}
+	return nil
+}
+
+func loadEnv(conf *Config) error {
+	for _, o := range options(conf) {
+		str, ok := os.LookupEnv(o.env())
+		if !ok {
+			continue
+		}
+		err := o.value.Set(str)
+		if err != nil {
+			return errors.New("invalid " + o.env() + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+func newFlagSet(name string, conf *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "path of a JSON config file")
+	for _, o := range options(conf) {
+		fs.Var(o.value, o.name, o.usage+" (env "+o.env()+")")
+	}
+	return fs
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const envPrefix = "SAFRAN_"
+
+// option is a setting overridable by a flag and an environment variable
+type option struct {
+	name  string
+	usage string
+	value flag.Value
+}
+
+// env return the environment variable of the option, ex: influx-url -> SAFRAN_INFLUX_URL
+func (o option) env() string {
+	return envPrefix + strings.ToUpper(strings.Replace(o.name, "-", "_", -1))
+}
+
+func options(conf *Config) []option {
+	return []option{
+		{"addr", "listen address of the http server", (*stringValue)(&conf.Addr)},
+		{"influx-url", "url of the influx server", (*stringValue)(&conf.Influx.URL)},
+		{"influx-database", "influx database", (*stringValue)(&conf.Influx.Database)},
+		{"influx-username", "influx username", (*stringValue)(&conf.Influx.Username)},
+		{"influx-password", "influx password", (*stringValue)(&conf.Influx.Password)},
+		{"influx-precision", "influx write precision", (*stringValue)(&conf.Influx.Precision)},
+		{"influx-timeout", "influx requests timeout", (*durationValue)(&conf.Influx.Timeout.Duration)},
+		{"influx-tls-insecure", "skip the influx certificate verification", (*boolValue)(&conf.Influx.TLS.Insecure)},
+		{"influx-tls-ca", "CA certificate of the influx server", (*stringValue)(&conf.Influx.TLS.CAFile)},
+		{"influx-retry-attempts", "attempts of an influx request, 1 to disable the retries", (*intValue)(&conf.Influx.Retry.Attempts)},
+		{"influx-retry-delay", "delay before retrying an influx request, doubled at each attempt", (*durationValue)(&conf.Influx.Retry.Delay.Duration)},
+		{"influx-retry-max-delay", "maximum delay between two attempts", (*durationValue)(&conf.Influx.Retry.MaxDelay.Duration)},
+		{"influx2-url", "url of the influx 2.x server", (*stringValue)(&conf.Influx2.URL)},
+		{"influx2-org", "influx 2.x organization", (*stringValue)(&conf.Influx2.Org)},
+		{"influx2-bucket", "influx 2.x bucket", (*stringValue)(&conf.Influx2.Bucket)},
+		{"influx2-token", "influx 2.x API token", (*stringValue)(&conf.Influx2.Token)},
+		{"influx2-precision", "influx 2.x write precision", (*stringValue)(&conf.Influx2.Precision)},
+		{"influx2-timeout", "influx 2.x requests timeout", (*durationValue)(&conf.Influx2.Timeout.Duration)},
+		{"influx2-tls-insecure", "skip the influx 2.x certificate verification", (*boolValue)(&conf.Influx2.TLS.Insecure)},
+		{"influx2-tls-ca", "CA certificate of the influx 2.x server", (*stringValue)(&conf.Influx2.TLS.CAFile)},
+		{"influx2-retry-attempts", "attempts of an influx 2.x request, 1 to disable the retries", (*intValue)(&conf.Influx2.Retry.Attempts)},
+		{"influx2-retry-delay", "delay before retrying an influx 2.x request, doubled at each attempt", (*durationValue)(&conf.Influx2.Retry.Delay.Duration)},
+		{"influx2-retry-max-delay", "maximum delay between two attempts", (*durationValue)(&conf.Influx2.Retry.MaxDelay.Duration)},
+		{"sql-driver", "driver of the sql output: sqlite3 or postgres", (*stringValue)(&conf.SQL.Driver)},
+		{"sql-dsn", "data source of the sql output, a file for sqlite3, whose imports wait for each other, or a connection string for postgres", (*stringValue)(&conf.SQL.DSN)},
+		{"output-dir", "directory of the file based outputs results, one sub directory per experiment", (*stringValue)(&conf.Output.Dir)},
+		{"imports-ttl", "retention of finished and abandoned imports, the running imports silent for as long being cancelled", (*durationValue)(&conf.Imports.TTL.Duration)},
+		{"imports-max", "maximum number of running imports", (*intValue)(&conf.Imports.Max)},
+		{"imports-workers", "samples parsing workers of an import, 0 for one per CPU", (*intValue)(&conf.Imports.Workers)},
+		{"imports-journal", "directory of the imports journal, used to detect re-uploads and resume crashed imports", (*stringValue)(&conf.Imports.Journal)},
+		{"dates-layouts", "comma separated go layouts of the header dates", (*listValue)(&conf.Dates.Layouts)},
+		{"dates-timezone", "time zone of the header dates and samples times", (*stringValue)(&conf.Dates.TimeZone)},
+		{"errors-policy", "handling of the malformed rows: strict, skip or quarantine", (*stringValue)(&conf.Errors.Policy)},
+		{"errors-max", "maximum number of rejected rows of an import, 0 for no limit", (*intValue)(&conf.Errors.Max)},
+		{"batch-lines", "lines parsed at once", (*intValue)(&conf.Batch.Lines)},
+		{"batch-samples", "samples saved at once, 0 for no limit", (*intValue)(&conf.Batch.Samples)},
+		{"batch-bytes", "bytes read before saving the samples, 0 for no limit", (*intValue)(&conf.Batch.Bytes)},
+		{"batch-interval", "maximum delay before saving the samples, 0 for no limit", (*durationValue)(&conf.Batch.Interval.Duration)},
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(str string) error {
+	*v = stringValue(str)
+	return nil
+}
+
+func (v *stringValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return string(*v)
+}
+
+type listValue []string
+
+func (v *listValue) Set(str string) error {
+	*v = strings.Split(str, ",")
+	return nil
+}
+
+func (v *listValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+type intValue int
+
+func (v *intValue) Set(str string) error {
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		return err
+	}
+	*v = intValue(i)
+	return nil
+}
+
+func (v *intValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*v))
+}
+
+type boolValue bool
+
+func (v *boolValue) Set(str string) error {
+	b, err := strconv.ParseBool(str)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string {
+	if v == nil {
+		return "false"
+	}
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(str string) error {
+	d, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string {
+	if v == nil {
+		return "0s"
+	}
+	return time.Duration(*v).String()
+}
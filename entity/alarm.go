@@ -1,8 +1,10 @@
 package entity
 
+import "time"
+
 // Alarm is a timeserie data
 type Alarm struct {
-	Time    string
+	Time    time.Time
 	Level   int
 	Message string
 }
@@ -0,0 +1,40 @@
+package entity
+
+import "strconv"
+
+const (
+	FileSamples = "samples"
+	FileAlarms  = "alarms"
+)
+
+// ParseError locate a parsing failure in an imported file so the user can fix it
+type ParseError struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Measure string `json:"measure,omitempty"`
+	Excerpt string `json:"excerpt,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *ParseError) Error() string {
+	msg := e.File + " line " + strconv.Itoa(e.Line)
+	if e.Column > 0 {
+		msg += ", column " + strconv.Itoa(e.Column)
+	}
+	if e.Measure != "" {
+		msg += " (" + e.Measure + ")"
+	}
+	msg += ": " + e.Message
+	// the column messages already quote their value
+	if e.Column == 0 && e.Excerpt != "" {
+		msg += ", near " + strconv.Quote(e.Excerpt)
+	}
+	return msg
+}
+
+// Reject is a malformed row dropped by a lenient import
+type Reject struct {
+	Raw   string
+	Error ParseError
+}
@@ -2,9 +2,15 @@ package entity
 
 import (
 	"errors"
+	"strings"
 	"time"
+
+	uuid "github.com/satori/go.uuid"
 )
 
+// experimentNamespace is the namespace of the experiments ids derived from their key
+var experimentNamespace = uuid.NewV5(uuid.NamespaceOID, "safran-server/experiment")
+
 // Experiment is the experiment
 type Experiment struct {
 	ID        string
@@ -16,6 +22,12 @@ type Experiment struct {
 	EndDate   time.Time
 }
 
+// Key return the id identifying the experiment by its reference, bench and campaign,
+// so uploading the same experiment again targets the same data
+func (e Experiment) Key() string {
+	return uuid.NewV5(experimentNamespace, strings.Join([]string{e.Reference, e.Bench, e.Campaign}, "\x00")).String()
+}
+
 // Validate check if current experiement is valide
 func (e Experiment) Validate() error {
 	if e.Reference == "" {
@@ -5,5 +5,6 @@ type Measure struct {
 	Name  string
 	Typex string
 	Unitx string
+	Type  ValueType
 	Inc   int
 }
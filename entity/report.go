@@ -1,6 +1,9 @@
 package entity
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 const (
 	TypeExperiment = "Experiment"
@@ -41,22 +44,31 @@ const (
 	StepFullEnd = "10_END"
 
 	StepCancel = "X_CANCEL"
+	StepPause  = "X_PAUSE"
+	StepResume = "X_RESUME"
+	StepSkip   = "X_SKIP"
 )
 
+// Report is the progress of an import, its files being relative to the experiment directory of the output
 type Report struct {
-	ID           int               `json:"id"`
-	Channel      string            `json:"channel"`
-	Type         string            `json:"type"`
-	Status       string            `json:"status"`
-	ExperimentID string            `json:"experimentID"`
-	HasAlarms    bool              `json:"hasAlarms"`
-	Progress     int               `json:"progress"`
-	SamplesSize  int64             `json:"samplesSize"`
-	AlarmsSize   int64             `json:"alarmsSize"`
-	Read         int64             `json:"read"`
-	Errors       map[string]string `json:"errors"`
-	Steps        map[string]bool   `json:"steps"`
-	Current      string            `json:"currentStep"`
+	ID           int                   `json:"id"`
+	Channel      string                `json:"channel"`
+	Type         string                `json:"type"`
+	Status       string                `json:"status"`
+	ExperimentID string                `json:"experimentID"`
+	HasAlarms    bool                  `json:"hasAlarms"`
+	Progress     int                   `json:"progress"`
+	SamplesSize  int64                 `json:"samplesSize"`
+	AlarmsSize   int64                 `json:"alarmsSize"`
+	AlarmsCount  int                   `json:"alarmsCount"`
+	Read         int64                 `json:"read"`
+	Rejected     int                   `json:"rejected"`
+	Retries      int                   `json:"retries"`
+	Errors       map[string]string     `json:"errors"`
+	ParseErrors  map[string]ParseError `json:"parseErrors,omitempty"`
+	Steps        map[string]bool       `json:"steps"`
+	Current      string                `json:"currentStep"`
+	Files        []string              `json:"files,omitempty"`
 }
 
 func NewReport(channel string) *Report {
@@ -75,6 +87,7 @@ func NewReport(channel string) *Report {
 		SamplesSize:  0,
 		AlarmsSize:   0,
 		Errors:       errors,
+		ParseErrors:  make(map[string]ParseError),
 		Steps:        steps,
 		Current:      StepInit,
 	}
@@ -94,10 +107,14 @@ func (r Report) Copy(t string) *Report {
 		Progress:     r.Progress,
 		SamplesSize:  r.SamplesSize,
 		AlarmsSize:   r.AlarmsSize,
+		AlarmsCount:  r.AlarmsCount,
 		Read:         0,
 		Errors:       errors,
+		ParseErrors:  make(map[string]ParseError),
 		Steps:        steps,
 		Current:      r.Current,
+		Files:        r.Files,
+		Retries:      r.Retries,
 	}
 }
 
@@ -112,6 +129,95 @@ func (r *Report) AddError(step string, err error) *Report {
 	r.Status = StatusFailure
 	r.Steps[step] = false
 	r.Errors[step] = err.Error()
+	if parseErr, ok := err.(*ParseError); ok {
+		r.AddParseError(step, *parseErr)
+	}
+	return r
+}
+
+// AddParseError keep the location of the error failing the step
+func (r *Report) AddParseError(step string, err ParseError) *Report {
+	if r.ParseErrors == nil {
+		r.ParseErrors = make(map[string]ParseError)
+	}
+	r.ParseErrors[step] = err
+	return r
+}
+
+// Clone returns a deep copy of the report, safe to hand over to another goroutine
+func (r Report) Clone() Report {
+	errors := make(map[string]string, len(r.Errors))
+	for step, err := range r.Errors {
+		errors[step] = err
+	}
+	steps := make(map[string]bool, len(r.Steps))
+	for step, ok := range r.Steps {
+		steps[step] = ok
+	}
+	r.Errors = errors
+	r.Steps = steps
+	if r.ParseErrors != nil {
+		parseErrors := make(map[string]ParseError, len(r.ParseErrors))
+		for step, err := range r.ParseErrors {
+			parseErrors[step] = err
+		}
+		r.ParseErrors = parseErrors
+	}
+	if r.Files != nil {
+		r.Files = append([]string(nil), r.Files...)
+	}
+	return r
+}
+
+// Merge fold a more recent report into this one, keeping the latest known state
+func (r *Report) Merge(o Report) *Report {
+	if o.ID >= r.ID {
+		r.ID = o.ID
+		r.Current = o.Current
+	}
+	if o.Type == TypeClient || o.Status == StatusFailure {
+		r.Status = o.Status
+	}
+	if o.ExperimentID != "" {
+		r.ExperimentID = o.ExperimentID
+	}
+	r.HasAlarms = r.HasAlarms || o.HasAlarms
+	// the alarms and experiment reports have their own progress, the import one is the samples progress
+	if o.Type == TypeSamples || o.Type == TypeClient {
+		if o.Progress > r.Progress {
+			r.Progress = o.Progress
+		}
+		if o.Read > r.Read {
+			r.Read = o.Read
+		}
+	}
+	if o.SamplesSize > 0 {
+		r.SamplesSize = o.SamplesSize
+	}
+	if o.AlarmsSize > 0 {
+		r.AlarmsSize = o.AlarmsSize
+	}
+	if o.AlarmsCount > r.AlarmsCount {
+		r.AlarmsCount = o.AlarmsCount
+	}
+	if o.Rejected > r.Rejected {
+		r.Rejected = o.Rejected
+	}
+	if o.Retries > r.Retries {
+		r.Retries = o.Retries
+	}
+	if len(o.Files) > 0 {
+		r.Files = append([]string(nil), o.Files...)
+	}
+	for step, err := range o.Errors {
+		r.Errors[step] = err
+	}
+	for step, err := range o.ParseErrors {
+		r.AddParseError(step, err)
+	}
+	for step, ok := range o.Steps {
+		r.Steps[step] = ok
+	}
 	return r
 }
 
@@ -120,9 +226,19 @@ func (r *Report) Step() *Report {
 	return r
 }
 
+// AddRead count the bytes read, the progress being against the alarms size for the alarms report
 func (r *Report) AddRead(size int) *Report {
 	r.Read += int64(size)
-	r.Progress = int((r.Read * 100) / r.SamplesSize)
+	total := r.SamplesSize
+	if r.Type == TypeAlarms {
+		total = r.AlarmsSize
+	}
+	if total > 0 {
+		r.Progress = int((r.Read * 100) / total)
+	}
+	if r.Progress > 100 {
+		r.Progress = 100
+	}
 	return r
 }
 
@@ -146,3 +262,19 @@ func (r Report) ToJSON() []byte {
 	}
 	return b
 }
+
+// StepType return the report type a step belongs to
+func StepType(step string) string {
+	switch {
+	case step == StepParseMeasures || step == StepSaveMeasures,
+		strings.HasPrefix(step, StepParseSamples),
+		strings.HasPrefix(step, StepSaveSamples):
+		return TypeSamples
+	case strings.HasPrefix(step, StepParseAlarms),
+		strings.HasPrefix(step, StepSaveAlarms):
+		return TypeAlarms
+	case step == StepFullEnd || step == StepCancel || step == StepSkip:
+		return TypeClient
+	}
+	return TypeExperiment
+}
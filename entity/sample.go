@@ -1,8 +1,10 @@
 package entity
 
+import "time"
+
 // Sample is a timeserie data
 type Sample struct {
-	Time  string
-	Value string
+	Time  time.Time
+	Value interface{}
 	Inc   int
 }
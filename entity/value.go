@@ -0,0 +1,100 @@
+package entity
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the native type of the values of a measure
+type ValueType string
+
+const (
+	ValueInt    ValueType = "int"
+	ValueFloat  ValueType = "float"
+	ValueBool   ValueType = "bool"
+	ValueString ValueType = "string"
+)
+
+// typeCodes map the type codes of the samples header to their native type
+var typeCodes = map[string]ValueType{
+	"D8":   ValueInt,
+	"D16":  ValueInt,
+	"D32":  ValueInt,
+	"D64":  ValueInt,
+	"S8":   ValueInt,
+	"S16":  ValueInt,
+	"S32":  ValueInt,
+	"S64":  ValueInt,
+	"U8":   ValueInt,
+	"U16":  ValueInt,
+	"U32":  ValueInt,
+	"U64":  ValueInt,
+	"F32":  ValueFloat,
+	"F64":  ValueFloat,
+	"L":    ValueFloat,
+	"I":    ValueFloat,
+	"B":    ValueBool,
+	"BOOL": ValueBool,
+}
+
+// TypeOf return the native type of a header type code, string when the code is unknown
+func TypeOf(code string) ValueType {
+	t, ok := typeCodes[strings.ToUpper(strings.TrimSpace(code))]
+	if !ok {
+		return ValueString
+	}
+	return t
+}
+
+// ParseValue convert a raw value (ex: 1011,078125 or 4,23E+09) to its native type:
+// int64, float64, bool or string
+func ParseValue(t ValueType, raw string) (interface{}, error) {
+	switch t {
+	case ValueInt:
+		number := normalizeNumber(raw)
+		i, err := strconv.ParseInt(number, 10, 64)
+		if err == nil {
+			return i, nil
+		}
+		// integers are often exported in scientific notation, ex: 4,23E+09
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt64 || f > math.MaxInt64 {
+			return nil, errors.New("invalid int value " + strconv.Quote(raw))
+		}
+		return int64(f), nil
+	case ValueFloat:
+		f, err := strconv.ParseFloat(normalizeNumber(raw), 64)
+		if err != nil {
+			return nil, errors.New("invalid float value " + strconv.Quote(raw))
+		}
+		return f, nil
+	case ValueBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, errors.New("invalid bool value " + strconv.Quote(raw))
+		}
+		return b, nil
+	}
+	return raw, nil
+}
+
+// FormatValue format a native value for the text outputs
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func normalizeNumber(raw string) string {
+	return strings.Replace(strings.TrimSpace(raw), ",", ".", 1)
+}
@@ -0,0 +1,63 @@
+package facade
+
+import (
+	"time"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// Flush tell when the parsed samples are saved, the first limit reached triggering a save,
+// every parsed batch is saved when no limit is set
+type Flush struct {
+	Samples  int
+	Bytes    int
+	Interval time.Duration
+}
+
+// buffer gather the parsed samples until the flush policy save them
+type buffer struct {
+	flush   Flush
+	samples []*entity.Sample
+	bytes   int
+	last    time.Time
+}
+
+func newBuffer(flush Flush) *buffer {
+	return &buffer{flush: flush, last: time.Now()}
+}
+
+// add the samples of a batch of size bytes, returning the chunks to save
+func (b *buffer) add(samples []*entity.Sample, size int) [][]*entity.Sample {
+	var chunks [][]*entity.Sample
+	b.samples = append(b.samples, samples...)
+	b.bytes += size
+
+	if max := b.flush.Samples; max > 0 {
+		for len(b.samples) >= max {
+			chunks = append(chunks, b.samples[:max:max])
+			b.samples = b.samples[max:]
+			b.last = time.Now()
+		}
+		if len(b.samples) == 0 {
+			b.bytes = 0
+		}
+	}
+
+	full := b.flush.Bytes > 0 && b.bytes >= b.flush.Bytes
+	late := b.flush.Interval > 0 && time.Since(b.last) >= b.flush.Interval
+	if b.flush == (Flush{}) || full || late {
+		if rest := b.drain(); len(rest) > 0 {
+			chunks = append(chunks, rest)
+		}
+	}
+	return chunks
+}
+
+// drain return the pending samples
+func (b *buffer) drain() []*entity.Sample {
+	samples := b.samples
+	b.samples = nil
+	b.bytes = 0
+	b.last = time.Now()
+	return samples
+}
@@ -0,0 +1,43 @@
+package facade
+
+import (
+	"runtime"
+
+	"github.com/leaklessgfy/safran-server/parser"
+	"github.com/leaklessgfy/safran-server/utils"
+)
+
+// Options tune how the facade parses the files
+type Options struct {
+	Dates      utils.DateFormat
+	Format     parser.Format
+	Policy     parser.Policy
+	MaxErrors  int
+	RejectsDir string
+	Workers    int
+	Lines      int
+	Flush      Flush
+	// Replace delete the data of a previous import of the experiment
+	Replace bool
+	// Append add the data to a previous import of the experiment
+	Append bool
+	// Resume skip what a crashed import of the same file already saved
+	Resume *Resume
+}
+
+// Resume is what a previous import saved before stopping
+type Resume struct {
+	Samples int
+	Alarms  bool
+}
+
+// DefaultOptions return the options matching the bench exports
+func DefaultOptions() Options {
+	return Options{
+		Dates:   utils.DefaultDateFormat,
+		Format:  parser.DefaultFormat,
+		Policy:  parser.PolicyStrict,
+		Workers: runtime.NumCPU(),
+		Lines:   500,
+	}
+}
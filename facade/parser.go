@@ -2,18 +2,29 @@ package facade
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log"
-	"strconv"
+	"sync"
 
 	"github.com/leaklessgfy/safran-server/entity"
 	"github.com/leaklessgfy/safran-server/observer"
 	"github.com/leaklessgfy/safran-server/output"
 	"github.com/leaklessgfy/safran-server/parser"
-	"github.com/leaklessgfy/safran-server/utils"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// ErrCancelled is reported when the import is cancelled by the user
+	ErrCancelled = errors.New("import cancelled by user")
+	// ErrOver is returned when controlling an import already ended or cancelled
+	ErrOver = errors.New("import already over")
+	// ErrNotPaused is returned when resuming an import which is not paused
+	ErrNotPaused = errors.New("import not paused")
 )
 
 type ParserFacade struct {
+	options       Options
 	output        output.Output
 	observer      observer.Observer
 	samplesParser *parser.SamplesParser
@@ -21,18 +32,26 @@ type ParserFacade struct {
 	ctx           context.Context
 	stop          context.CancelFunc
 	events        chan Event
+	rejects       *rejects
+	lock          sync.Mutex
+	done          sync.Once
+	pause         sync.Mutex
+	gate          chan struct{}
 }
 
-func NewParserFacade(output output.Output, observer observer.Observer, samplesReader, alarmsReader io.Reader) *ParserFacade {
-	samplesParser := parser.NewSamplesParser(samplesReader)
+func NewParserFacade(output output.Output, observer observer.Observer, samplesReader, alarmsReader io.Reader, options Options) *ParserFacade {
+	samplesParser := parser.NewSamplesParser(samplesReader, options.Format)
+	samplesParser.SetPolicy(options.Policy)
 	var alarmsParser *parser.AlarmsParser
 	if alarmsReader != nil {
 		alarmsParser = parser.NewAlarmsParser(alarmsReader)
+		alarmsParser.SetPolicy(options.Policy)
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 	events := make(chan Event, 10)
 
 	return &ParserFacade{
+		options:       options,
 		output:        output,
 		observer:      observer,
 		samplesParser: samplesParser,
@@ -40,13 +59,19 @@ func NewParserFacade(output output.Output, observer observer.Observer, samplesRe
 		ctx:           ctx,
 		stop:          cancel,
 		events:        events,
+		rejects:       newRejects(options),
 	}
 }
 
-func (p ParserFacade) Parse(experiment *entity.Experiment) error {
+func (p *ParserFacade) Parse(experiment *entity.Experiment) error {
+	if retry, ok := p.output.(output.RetryOutput); ok {
+		retry.OnRetry(p.observer.OnRetry)
+	}
+	if out, ok := p.output.(output.ContextOutput); ok {
+		out.SetContext(p.ctx)
+	}
 	err := p.importExperiment(experiment)
 	if err != nil {
-		p.output.Cancel()
 		return err
 	}
 	max := 2
@@ -61,9 +86,69 @@ func (p ParserFacade) Parse(experiment *entity.Experiment) error {
 	return nil
 }
 
-func (p ParserFacade) initEvents(max int) {
+// Cancel abort the running import and rollback what was already saved
+func (p *ParserFacade) Cancel() error {
+	cancelled := false
+	p.done.Do(func() {
+		p.stop()
+		p.rollback(entity.StepCancel, ErrCancelled)
+		cancelled = true
+	})
+	if !cancelled {
+		return ErrOver
+	}
+	return nil
+}
+
+// Pause suspend the parsing until Resume is called, batches already parsed are still saved
+func (p *ParserFacade) Pause() error {
+	p.pause.Lock()
+	defer p.pause.Unlock()
+
+	if p.hasError() {
+		return ErrOver
+	}
+	if p.gate == nil {
+		p.gate = make(chan struct{})
+		p.observer.OnStep(entity.StepPause)
+	}
+	return nil
+}
+
+// Resume restart a paused parsing
+func (p *ParserFacade) Resume() error {
+	p.pause.Lock()
+	defer p.pause.Unlock()
+
+	if p.hasError() {
+		return ErrOver
+	}
+	if p.gate == nil {
+		return ErrNotPaused
+	}
+	close(p.gate)
+	p.gate = nil
+	p.observer.OnStep(entity.StepResume)
+	return nil
+}
+
+// wait block while the import is paused
+func (p *ParserFacade) wait() {
+	p.pause.Lock()
+	gate := p.gate
+	p.pause.Unlock()
+
+	if gate == nil {
+		return
+	}
+	select {
+	case <-gate:
+	case <-p.ctx.Done():
+	}
+}
+
+func (p *ParserFacade) initEvents(max int) {
 	var inc int
-	var err error
 
 	for {
 		select {
@@ -74,31 +159,22 @@ func (p ParserFacade) initEvents(max int) {
 			case EndID:
 				inc++
 				if inc == max {
-					p.stop()
-					err = p.output.End()
-					if err != nil {
-						p.output.Cancel()
-						return
-					}
-					p.observer.OnStep(event.step)
+					p.end(event.step)
 					return
 				}
 				break
 			case MeasureID:
-				err = p.output.SaveMeasures(event.measures)
-				if p.handleError(event.step, err) {
+				if p.save(event.step, -1, func() error { return p.output.SaveMeasures(event.measures) }) {
 					return
 				}
 				break
 			case SamplesID:
-				err = p.output.SaveSamples(event.samples)
-				if p.handleError(event.step, err) {
+				if p.save(event.step, len(event.samples), func() error { return p.output.SaveSamples(event.samples) }) {
 					return
 				}
 				break
 			case AlarmsID:
-				err = p.output.SaveAlarms(event.alarms)
-				if p.handleError(event.step, err) {
+				if p.save(event.step, len(event.alarms), func() error { return p.output.SaveAlarms(event.alarms) }) {
 					return
 				}
 				break
@@ -107,32 +183,114 @@ func (p ParserFacade) initEvents(max int) {
 	}
 }
 
-func (p ParserFacade) importExperiment(experiment *entity.Experiment) error {
+// save run an output call, never concurrently with a rollback nor once the import is stopped,
+// nothing is reported when the import was stopped meanwhile, the rollback undoing the save
+func (p *ParserFacade) save(step string, count int, call func() error) bool {
+	p.lock.Lock()
+	if p.hasError() {
+		p.lock.Unlock()
+		return true
+	}
+	err := call()
+	if err == nil && !p.hasError() {
+		p.observer.OnStep(step)
+		if count >= 0 {
+			p.observer.OnSaved(step, count)
+		}
+		p.lock.Unlock()
+		return false
+	}
+	p.lock.Unlock()
+	return p.handleError(step, err)
+}
+
+func (p *ParserFacade) end(step string) {
+	p.done.Do(func() {
+		p.stop()
+		p.lock.Lock()
+		err := p.output.End()
+		p.lock.Unlock()
+		if err != nil {
+			p.rollback(step, err)
+			return
+		}
+		rejects, err := p.rejects.close()
+		if err != nil {
+			p.rollback(step, err)
+			return
+		}
+		var files []string
+		if out, ok := p.output.(output.FileOutput); ok {
+			files = out.Files()
+		}
+		files = append(files, rejects...)
+		if len(files) > 0 {
+			p.observer.OnFiles(files)
+		}
+		p.observer.OnStep(step)
+	})
+}
+
+func (p *ParserFacade) importExperiment(experiment *entity.Experiment) error {
 	header, size, err := p.samplesParser.ParseHeader()
-	p.observer.OnRead(size)
+	p.observer.OnRead(entity.FileSamples, size)
 	if p.handleError(entity.StepParseHeader, err) {
 		return err
 	}
 
-	experiment.StartDate, err = utils.ParseDate(header.StartDate)
+	experiment.StartDate, err = p.options.Dates.Parse(header.StartDate)
 	if p.handleError(entity.StepParseStartDate, err) {
 		return err
 	}
 
-	experiment.EndDate, err = utils.ParseDate(header.EndDate)
+	experiment.EndDate, err = p.options.Dates.Parse(header.EndDate)
 	if p.handleError(entity.StepParseEndDate, err) {
 		return err
 	}
 
-	err = p.output.SaveExperiment(experiment)
+	p.samplesParser.SetRecord(experiment.StartDate, experiment.EndDate)
+	if p.alarmsParser != nil {
+		p.alarmsParser.SetRecord(experiment.StartDate, experiment.EndDate)
+	}
+
+	if experiment.ID == "" {
+		experiment.ID = uuid.NewV4().String()
+	}
+	p.rejects.setExperiment(experiment)
+	err = p.saveExperiment(experiment)
 	if p.handleError(entity.StepSaveExperiment, err) {
 		return err
 	}
+	p.observer.OnExperiment(experiment)
 
 	return nil
 }
 
-func (p ParserFacade) importFull() {
+// saveExperiment start the experiment over, or continue it when appending or resuming
+func (p *ParserFacade) saveExperiment(experiment *entity.Experiment) error {
+	if p.options.Append || p.options.Resume != nil {
+		if out, ok := p.output.(output.AppendOutput); ok {
+			return out.Append(experiment)
+		}
+		if p.options.Append {
+			return errors.New("the output can't append to an experiment")
+		}
+		// the output can't continue the crashed import, it starts over
+		p.options.Resume = nil
+		p.options.Replace = true
+	}
+	if p.options.Replace {
+		if out, ok := p.output.(output.RemoveOutput); ok {
+			err := out.Remove(experiment.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return p.output.SaveExperiment(experiment)
+}
+
+func (p *ParserFacade) importFull() {
 	err := p.importMeasures()
 	if err != nil || p.hasError() {
 		return
@@ -140,13 +298,13 @@ func (p ParserFacade) importFull() {
 	p.importSamples()
 }
 
-func (p ParserFacade) importMeasures() error {
+func (p *ParserFacade) importMeasures() error {
 	if p.hasError() {
 		return nil
 	}
 
 	measures, size, err := p.samplesParser.ParseMeasures()
-	p.observer.OnRead(size)
+	p.observer.OnRead(entity.FileSamples, size)
 	if p.handleError(entity.StepParseMeasures, err) || p.hasError() {
 		return err
 	}
@@ -155,97 +313,110 @@ func (p ParserFacade) importMeasures() error {
 	return nil
 }
 
-func (p ParserFacade) importSamples() {
-	if p.hasError() {
-		return
-	}
-
-	inc := 0
-	for !p.hasError() {
-		inc++
-		strInc := strconv.Itoa(inc)
-
-		samples, size, end := p.samplesParser.ParseSamples(500)
-		p.observer.OnRead(size)
-		p.observer.OnStep(entity.StepParseSamples + strInc)
-
-		p.dispatchSamples(samples, strInc)
-		if p.hasError() {
-			return
-		}
-
-		if end {
-			p.dispatchEnd()
-			p.observer.OnEndSamples()
-			return
-		}
-	}
-}
-
-func (p ParserFacade) importAlarms() {
+func (p *ParserFacade) importAlarms() {
 	if p.hasError() {
 		return
 	}
 
+	p.wait()
 	alarms, size, err := p.alarmsParser.ParseAlarms()
-	p.observer.OnRead(size)
+	p.observer.OnRead(entity.FileAlarms, size)
+	if err == nil {
+		err = p.reject(entity.StepParseAlarms+"1", p.alarmsParser.Rejects())
+	}
 	if p.handleError(entity.StepParseAlarms+"1", err) || p.hasError() {
 		return
 	}
 
-	p.dispatchAlarms(alarms, "1")
-	if p.hasError() {
-		return
+	if p.options.Resume == nil || !p.options.Resume.Alarms {
+		p.dispatchAlarms(alarms, "1")
+		if p.hasError() {
+			return
+		}
 	}
 
 	p.dispatchEnd()
-	p.observer.OnEndAlarms()
+	p.observer.OnEndAlarms(len(alarms))
 }
 
-func (p ParserFacade) dispatchMeasures(measures []*entity.Measure) {
-	p.events <- Event{
+func (p *ParserFacade) dispatchMeasures(measures []*entity.Measure) {
+	p.dispatch(Event{
 		id:       MeasureID,
 		step:     entity.StepSaveMeasures,
 		measures: measures,
-	}
+	})
 }
 
-func (p ParserFacade) dispatchSamples(samples []*entity.Sample, inc string) {
-	p.events <- Event{
+func (p *ParserFacade) dispatchSamples(samples []*entity.Sample, inc string) {
+	p.dispatch(Event{
 		id:      SamplesID,
 		step:    entity.StepSaveSamples + inc,
 		samples: samples,
-	}
+	})
 }
 
-func (p ParserFacade) dispatchAlarms(alarms []*entity.Alarm, inc string) {
-	p.events <- Event{
+func (p *ParserFacade) dispatchAlarms(alarms []*entity.Alarm, inc string) {
+	p.dispatch(Event{
 		id:     AlarmsID,
 		step:   entity.StepSaveAlarms + inc,
 		alarms: alarms,
+	})
+}
+
+func (p *ParserFacade) dispatchEnd() {
+	p.dispatch(Event{id: EndID, step: entity.StepFullEnd})
+}
+
+// dispatch send the event to the saving goroutine unless the import is over
+func (p *ParserFacade) dispatch(event Event) {
+	select {
+	case p.events <- event:
+	case <-p.ctx.Done():
 	}
 }
 
-func (p ParserFacade) dispatchEnd() {
-	p.events <- Event{id: EndID, step: entity.StepFullEnd}
+// reject report the rows dropped by the parsers, it fails past the max errors
+func (p *ParserFacade) reject(step string, rows []entity.Reject) error {
+	if len(rows) < 1 {
+		return nil
+	}
+	p.observer.OnReject(step, len(rows))
+	return p.rejects.add(rows)
 }
 
-func (p ParserFacade) handleError(step string, err error) bool {
+// handleError report the step, rolling back the import on error,
+// nothing is reported once the import is stopped so no step follows the last report
+func (p *ParserFacade) handleError(step string, err error) bool {
+	p.lock.Lock()
+	if p.hasError() {
+		p.lock.Unlock()
+		return true
+	}
 	p.observer.OnStep(step)
+	p.lock.Unlock()
 	if err != nil {
-		p.stop()
-		errCancel := p.output.Cancel()
-		if errCancel != nil {
-			log.Println("[ERROR CANCEL]", errCancel)
-		}
-		p.observer.OnError(step, err)
-		p.observer.OnStep(entity.StepCancel)
+		p.done.Do(func() {
+			p.stop()
+			p.rollback(step, err)
+		})
 		return true
 	}
 	return false
 }
 
-func (p ParserFacade) hasError() bool {
+func (p *ParserFacade) rollback(step string, err error) {
+	p.lock.Lock()
+	errCancel := p.output.Cancel()
+	p.lock.Unlock()
+	if errCancel != nil {
+		log.Println("[ERROR CANCEL]", errCancel)
+	}
+	p.rejects.remove()
+	p.observer.OnError(step, err)
+	p.observer.OnStep(entity.StepCancel)
+}
+
+func (p *ParserFacade) hasError() bool {
 	select {
 	case <-p.ctx.Done():
 		return true
@@ -0,0 +1,78 @@
+package facade
+
+import (
+	"bytes"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/leaklessgfy/safran-server/output"
+)
+
+// doneObserver ignore the import events but the last step, sent to done
+type doneObserver struct {
+	done chan string
+}
+
+func (o doneObserver) OnExperiment(*entity.Experiment) {}
+
+func (o doneObserver) OnStep(step string) {
+	if step == entity.StepFullEnd || step == entity.StepCancel {
+		o.done <- step
+	}
+}
+
+func (o doneObserver) OnError(string, error) {}
+
+func (o doneObserver) OnRead(string, int) {}
+
+func (o doneObserver) OnEndSamples() {}
+
+func (o doneObserver) OnEndAlarms(int) {}
+
+func (o doneObserver) OnFiles([]string) {}
+
+func (o doneObserver) OnReject(string, int) {}
+
+func (o doneObserver) OnRetry(int, error) {}
+
+func (o doneObserver) OnSaved(string, int) {}
+
+// benchLines is the rows of a batch in BenchmarkImportSamples, csv/testfile.csv having 73 rows of samples
+// it's cut in 19 batches the workers convert concurrently
+const benchLines = 4
+
+// BenchmarkImportSamples import csv/testfile.csv in an empty output, with a single worker and with a worker per CPU,
+// at least 2 so the batches are converted concurrently
+func BenchmarkImportSamples(b *testing.B) {
+	samples, err := ioutil.ReadFile("../csv/testfile.csv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	n := runtime.NumCPU()
+	if n < 2 {
+		n = 2
+	}
+	for _, workers := range []int{1, n} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			options := DefaultOptions()
+			options.Workers = workers
+			options.Lines = benchLines
+			b.SetBytes(int64(len(samples)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				observer := doneObserver{done: make(chan string, 1)}
+				facade := NewParserFacade(output.EmptyOutput{}, observer, bytes.NewReader(samples), nil, options)
+				err := facade.Parse(&entity.Experiment{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if step := <-observer.done; step != entity.StepFullEnd {
+					b.Fatal("import ended with " + step)
+				}
+			}
+		})
+	}
+}
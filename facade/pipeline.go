@@ -0,0 +1,147 @@
+package facade
+
+import (
+	"strconv"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/leaklessgfy/safran-server/parser"
+)
+
+// batchJob is a batch travelling through the pipeline, done is closed once it's converted
+type batchJob struct {
+	batch *parser.Batch
+	end   bool
+	err   error
+	done  chan struct{}
+}
+
+// importSamples run the samples pipeline: one reader, the workers converting the batches concurrently,
+// and this goroutine resolving them in the file order and saving them according to the flush policy.
+// At most workers batches are in flight so a slow output holds back the reading.
+func (p *ParserFacade) importSamples() {
+	if p.hasError() {
+		return
+	}
+
+	workers := p.options.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *batchJob)
+	ordered := make(chan *batchJob, workers)
+
+	for i := 0; i < workers; i++ {
+		go p.convertBatches(jobs)
+	}
+	go p.readBatches(jobs, ordered)
+
+	buffer := newBuffer(p.options.Flush)
+	inc, saves := 0, 0
+	skip := 0
+	if p.options.Resume != nil {
+		skip = p.options.Resume.Samples
+	}
+	save := func(chunks ...[]*entity.Sample) bool {
+		for _, samples := range chunks {
+			// the samples saved before the crash are parsed again but not saved
+			if skip > 0 {
+				n := skip
+				if n > len(samples) {
+					n = len(samples)
+				}
+				samples = samples[n:]
+				skip -= n
+			}
+			if len(samples) < 1 {
+				continue
+			}
+			saves++
+			p.dispatchSamples(samples, strconv.Itoa(saves))
+			if p.hasError() {
+				return false
+			}
+		}
+		return true
+	}
+
+	for job := range ordered {
+		select {
+		case <-job.done:
+		case <-p.ctx.Done():
+			return
+		}
+		inc++
+		strInc := strconv.Itoa(inc)
+
+		p.observer.OnRead(entity.FileSamples, job.batch.Size())
+		err := job.err
+		var samples []*entity.Sample
+		if err == nil {
+			samples, err = p.samplesParser.Resolve(job.batch)
+		}
+		if err == nil {
+			err = p.reject(entity.StepParseSamples+strInc, p.samplesParser.Rejects())
+		}
+		if p.handleError(entity.StepParseSamples+strInc, err) {
+			return
+		}
+
+		if !save(buffer.add(samples, job.batch.Size())...) {
+			return
+		}
+
+		if job.end {
+			if !save(buffer.drain()) {
+				return
+			}
+			p.dispatchEnd()
+			p.observer.OnEndSamples()
+			return
+		}
+	}
+}
+
+// readBatches read the batches in the file order, handing them to the workers and the saving goroutine
+func (p *ParserFacade) readBatches(jobs, ordered chan<- *batchJob) {
+	defer close(ordered)
+	defer close(jobs)
+
+	lines := p.options.Lines
+	if lines < 1 {
+		lines = DefaultOptions().Lines
+	}
+
+	for !p.hasError() {
+		p.wait()
+		if p.hasError() {
+			return
+		}
+
+		batch, end, err := p.samplesParser.ReadBatch(lines)
+		job := &batchJob{batch: batch, end: end, err: err, done: make(chan struct{})}
+		select {
+		case ordered <- job:
+		case <-p.ctx.Done():
+			return
+		}
+		if err != nil {
+			close(job.done)
+			return
+		}
+		select {
+		case jobs <- job:
+		case <-p.ctx.Done():
+			return
+		}
+		if end {
+			return
+		}
+	}
+}
+
+func (p *ParserFacade) convertBatches(jobs <-chan *batchJob) {
+	for job := range jobs {
+		p.samplesParser.Convert(job.batch)
+		close(job.done)
+	}
+}
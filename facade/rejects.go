@@ -0,0 +1,111 @@
+package facade
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/leaklessgfy/safran-server/parser"
+)
+
+// rejects count the rows dropped by a lenient import, writing them in root/{experimentID}/rejects.csv when quarantined
+type rejects struct {
+	policy parser.Policy
+	max    int
+	root   string
+	dir    string
+	count  int
+	file   *os.File
+	writer *csv.Writer
+	lock   sync.Mutex
+}
+
+func newRejects(options Options) *rejects {
+	return &rejects{policy: options.Policy, max: options.MaxErrors, root: options.RejectsDir}
+}
+
+func (r *rejects) setExperiment(experiment *entity.Experiment) {
+	r.dir = filepath.Join(r.root, experiment.ID)
+}
+
+// add count the rows, it fails when there are more rejected rows than allowed
+func (r *rejects) add(rows []entity.Reject) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.count += len(rows)
+	if r.policy == parser.PolicyQuarantine {
+		err := r.write(rows)
+		if err != nil {
+			return err
+		}
+	}
+	if r.max > 0 && r.count > r.max {
+		last := rows[len(rows)-1].Error
+		return errors.New(
+			"Too many rejected rows, " + strconv.Itoa(r.count) + " for " + strconv.Itoa(r.max) +
+				" allowed, last: " + last.Error(),
+		)
+	}
+	return nil
+}
+
+func (r *rejects) write(rows []entity.Reject) error {
+	if r.file == nil {
+		err := os.MkdirAll(r.dir, 0777)
+		if err != nil {
+			return err
+		}
+		r.file, err = os.Create(filepath.Join(r.dir, "rejects.csv"))
+		if err != nil {
+			return err
+		}
+		r.writer = csv.NewWriter(r.file)
+		r.writer.Write([]string{"file", "line", "column", "measure", "error", "row"})
+	}
+	for _, row := range rows {
+		r.writer.Write([]string{
+			row.Error.File,
+			strconv.Itoa(row.Error.Line),
+			strconv.Itoa(row.Error.Column),
+			row.Error.Measure,
+			row.Error.Message,
+			row.Raw,
+		})
+	}
+	r.writer.Flush()
+	return r.writer.Error()
+}
+
+// close the rejects file, returning its path in the experiment directory or nothing when no row was quarantined
+func (r *rejects) close() ([]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return nil, nil
+	}
+	err := r.file.Close()
+	if err != nil {
+		return nil, err
+	}
+	return []string{filepath.Base(r.file.Name())}, nil
+}
+
+// remove the rejects file of a cancelled import
+func (r *rejects) remove() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return
+	}
+	r.file.Close()
+	os.Remove(r.file.Name())
+	// the experiment directory is only removed when it held nothing else
+	os.Remove(r.dir)
+}
@@ -4,4 +4,11 @@ go 1.12
 
 require github.com/satori/go.uuid v1.2.0
 
-require github.com/influxdata/influxdb1-client v0.0.0-20190402204710-8ff2fc3824fc
+require (
+	github.com/gorilla/websocket v1.5.0
+	github.com/influxdata/influxdb1-client v0.0.0-20190402204710-8ff2fc3824fc
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/xitongsys/parquet-go v1.6.2
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0
+)
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	StatusRunning = "running"
+	StatusDone    = "done"
+)
+
+// Record is what an import of an experiment saved, kept on disk to detect re-uploads and resume after a crash
+type Record struct {
+	ExperimentID string    `json:"experimentID"`
+	Reference    string    `json:"reference"`
+	Bench        string    `json:"bench"`
+	Campaign     string    `json:"campaign"`
+	Output       string    `json:"output"`
+	Hash         string    `json:"hash"`
+	Status       string    `json:"status"`
+	Samples      int       `json:"samples"`
+	Alarms       bool      `json:"alarms"`
+	Updated      time.Time `json:"updated"`
+}
+
+// Journal store a record per output and experiment in dir/{output}/{experimentID}.json
+type Journal struct {
+	dir  string
+	lock sync.Mutex
+}
+
+// NewJournal create a journal in the directory
+func NewJournal(dir string) (*Journal, error) {
+	err := os.MkdirAll(dir, 0777)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{dir: dir}, nil
+}
+
+// Get return the record of the experiment in the output, false when it was never imported
+func (j *Journal) Get(output, experimentID string) (Record, bool, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	var record Record
+	b, err := ioutil.ReadFile(j.path(output, experimentID))
+	if os.IsNotExist(err) {
+		return record, false, nil
+	}
+	if err != nil {
+		return record, false, err
+	}
+	err = json.Unmarshal(b, &record)
+	if err != nil {
+		return record, false, err
+	}
+	return record, true, nil
+}
+
+// Save write the record, replacing the file at once so a crash never leaves half a record
+func (j *Journal) Save(record Record) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	record.Updated = time.Now()
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	path := j.path(record.Output, record.ExperimentID)
+	err = os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(path+".tmp", b, 0666)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Delete remove the record of the experiment in the output
+func (j *Journal) Delete(output, experimentID string) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	err := os.Remove(j.path(output, experimentID))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (j *Journal) path(output, experimentID string) string {
+	return filepath.Join(j.dir, output, experimentID+".json")
+}
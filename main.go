@@ -1,16 +1,29 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
+	"github.com/leaklessgfy/safran-server/config"
 	"github.com/leaklessgfy/safran-server/server"
 )
 
 func main() {
-	server := server.NewServer()
+	conf, err := config.Load(os.Args[0], os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	server, err := server.NewServer(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Println("Start Server on :8888")
-	err := server.Start(":8888")
+	log.Println("Start Server on " + conf.Addr)
+	err = server.Start()
 	if err != nil {
 		log.Fatal(err)
 	}
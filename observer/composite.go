@@ -1,9 +1,22 @@
 package observer
 
+import "github.com/leaklessgfy/safran-server/entity"
+
 type CompositeObserver struct {
 	observers []Observer
 }
 
+// NewCompositeObserver create an observer forwarding every event to observers
+func NewCompositeObserver(observers ...Observer) *CompositeObserver {
+	return &CompositeObserver{observers: observers}
+}
+
+func (o CompositeObserver) OnExperiment(experiment *entity.Experiment) {
+	for _, observer := range o.observers {
+		observer.OnExperiment(experiment)
+	}
+}
+
 func (o CompositeObserver) OnStep(step string) {
 	for _, observer := range o.observers {
 		observer.OnStep(step)
@@ -16,9 +29,9 @@ func (o CompositeObserver) OnError(step string, err error) {
 	}
 }
 
-func (o CompositeObserver) OnRead(size int) {
+func (o CompositeObserver) OnRead(file string, size int) {
 	for _, observer := range o.observers {
-		observer.OnRead(size)
+		observer.OnRead(file, size)
 	}
 }
 
@@ -28,8 +41,32 @@ func (o CompositeObserver) OnEndSamples() {
 	}
 }
 
-func (o CompositeObserver) OnEndAlarms() {
+func (o CompositeObserver) OnEndAlarms(count int) {
+	for _, observer := range o.observers {
+		observer.OnEndAlarms(count)
+	}
+}
+
+func (o CompositeObserver) OnFiles(files []string) {
+	for _, observer := range o.observers {
+		observer.OnFiles(files)
+	}
+}
+
+func (o CompositeObserver) OnReject(step string, count int) {
+	for _, observer := range o.observers {
+		observer.OnReject(step, count)
+	}
+}
+
+func (o CompositeObserver) OnRetry(attempt int, err error) {
+	for _, observer := range o.observers {
+		observer.OnRetry(attempt, err)
+	}
+}
+
+func (o CompositeObserver) OnSaved(step string, count int) {
 	for _, observer := range o.observers {
-		observer.OnEndAlarms()
+		observer.OnSaved(step, count)
 	}
 }
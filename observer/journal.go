@@ -0,0 +1,101 @@
+package observer
+
+import (
+	"log"
+	"sync"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/leaklessgfy/safran-server/journal"
+)
+
+// JournalObserver keep the journal record of the import up to date with what is saved,
+// nothing being written anymore once the import is cancelled
+type JournalObserver struct {
+	journal   *journal.Journal
+	record    journal.Record
+	previous  *journal.Record
+	cancelled bool
+	mutex     sync.Mutex
+}
+
+// NewJournalObserver create an observer saving the progress of the import in the record,
+// previous is the record put back on cancel when the import appends to an experiment, nil otherwise
+func NewJournalObserver(j *journal.Journal, record journal.Record, previous *journal.Record) *JournalObserver {
+	return &JournalObserver{journal: j, record: record, previous: previous}
+}
+
+func (o *JournalObserver) OnExperiment(experiment *entity.Experiment) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.cancelled {
+		return
+	}
+	o.record.ExperimentID = experiment.ID
+	o.record.Status = journal.StatusRunning
+	o.save()
+}
+
+func (o *JournalObserver) OnStep(step string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.cancelled {
+		return
+	}
+	switch step {
+	case entity.StepFullEnd:
+		o.record.Status = journal.StatusDone
+		o.save()
+	case entity.StepCancel:
+		// the output rolled back what the import saved, leaving the experiment as the previous import did
+		o.cancelled = true
+		var err error
+		if o.previous != nil {
+			err = o.journal.Save(*o.previous)
+		} else {
+			err = o.journal.Delete(o.record.Output, o.record.ExperimentID)
+		}
+		if err != nil {
+			log.Println("[JOURNAL]", err)
+		}
+	}
+}
+
+func (o *JournalObserver) OnError(step string, err error) {}
+
+func (o *JournalObserver) OnRead(file string, size int) {}
+
+func (o *JournalObserver) OnEndSamples() {}
+
+func (o *JournalObserver) OnEndAlarms(count int) {}
+
+func (o *JournalObserver) OnFiles(files []string) {}
+
+func (o *JournalObserver) OnReject(step string, count int) {}
+
+func (o *JournalObserver) OnRetry(attempt int, err error) {}
+
+// OnSaved record the samples and alarms saved by the output, from where a crashed import resumes
+func (o *JournalObserver) OnSaved(step string, count int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.cancelled {
+		return
+	}
+	switch entity.StepType(step) {
+	case entity.TypeSamples:
+		o.record.Samples += count
+	case entity.TypeAlarms:
+		o.record.Alarms = true
+	}
+	o.save()
+}
+
+func (o *JournalObserver) save() {
+	err := o.journal.Save(o.record)
+	if err != nil {
+		log.Println("[JOURNAL]", err)
+	}
+}
@@ -2,10 +2,16 @@ package observer
 
 import (
 	"log"
+
+	"github.com/leaklessgfy/safran-server/entity"
 )
 
 type LoggerObserver struct{}
 
+func (o LoggerObserver) OnExperiment(experiment *entity.Experiment) {
+	log.Println("[EXPERIMENT]", experiment.ID)
+}
+
 func (o LoggerObserver) OnStep(step string) {
 	log.Println("[STEP]", step)
 }
@@ -14,14 +20,30 @@ func (o LoggerObserver) OnError(step string, err error) {
 	log.Println("[ERROR]", step, err)
 }
 
-func (o LoggerObserver) OnRead(size int) {
-	log.Println("[READ]", size)
+func (o LoggerObserver) OnRead(file string, size int) {
+	log.Println("[READ]", file, size)
 }
 
 func (o LoggerObserver) OnEndSamples() {
 	log.Println("[END] Samples")
 }
 
-func (o LoggerObserver) OnEndAlarms() {
-	log.Println("[END] Alarms")
+func (o LoggerObserver) OnEndAlarms(count int) {
+	log.Println("[END] Alarms", count)
+}
+
+func (o LoggerObserver) OnFiles(files []string) {
+	log.Println("[FILES]", len(files))
+}
+
+func (o LoggerObserver) OnReject(step string, count int) {
+	log.Println("[REJECT]", step, count)
+}
+
+func (o LoggerObserver) OnRetry(attempt int, err error) {
+	log.Println("[RETRY]", attempt, err)
+}
+
+func (o LoggerObserver) OnSaved(step string, count int) {
+	log.Println("[SAVED]", step, count)
 }
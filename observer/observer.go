@@ -1,9 +1,16 @@
 package observer
 
+import "github.com/leaklessgfy/safran-server/entity"
+
 type Observer interface {
+	OnExperiment(*entity.Experiment)
 	OnStep(string)
 	OnError(string, error)
-	OnRead(int)
+	OnRead(string, int)
 	OnEndSamples()
-	OnEndAlarms()
+	OnEndAlarms(int)
+	OnFiles([]string)
+	OnReject(string, int)
+	OnRetry(int, error)
+	OnSaved(string, int)
 }
@@ -1,24 +1,160 @@
 package observer
 
+import (
+	"sync"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// Publisher receive the reports built by a ReportObserver
+type Publisher interface {
+	Publish(entity.Report)
+}
+
+// ReportObserver translate the import events into reports sent to a publisher
 type ReportObserver struct {
+	mutex     sync.Mutex
+	publisher Publisher
+	report    *entity.Report
+	samples   *entity.Report
+	alarms    *entity.Report
+}
+
+// NewReportObserver create a report observer sending to publisher
+func NewReportObserver(report entity.Report, publisher Publisher) *ReportObserver {
+	base := report.Clone()
+
+	return &ReportObserver{
+		publisher: publisher,
+		report:    &base,
+		samples:   base.Copy(entity.TypeSamples),
+		alarms:    base.Copy(entity.TypeAlarms),
+	}
+}
+
+func (o *ReportObserver) OnExperiment(experiment *entity.Experiment) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for _, report := range []*entity.Report{o.report, o.samples, o.alarms} {
+		report.ExperimentID = experiment.ID
+	}
+	o.push(o.report)
+}
+
+func (o *ReportObserver) OnStep(step string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if entity.StepType(step) == entity.TypeClient {
+		o.push(o.client(step))
+		return
+	}
+	report := o.reportOf(step)
+	o.push(report.AddSuccess(step))
 }
 
-func (o ReportObserver) OnStep(step string) {
+func (o *ReportObserver) OnError(step string, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
 
+	report := o.reportOf(step)
+	o.push(report.AddError(step, err))
 }
 
-func (o ReportObserver) OnError(step string, err error) {
+// OnRead count the bytes read of the file in its report, the samples ones making the import progress
+func (o *ReportObserver) OnRead(file string, size int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
 
+	if file == entity.FileAlarms {
+		o.alarms.AddRead(size)
+		return
+	}
+	o.samples.AddRead(size)
 }
 
-func (o ReportObserver) OnRead(size int) {
+func (o *ReportObserver) OnEndSamples() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
 
+	o.samples.End()
+	o.push(o.samples)
 }
 
-func (o ReportObserver) OnEndSamples() {
+func (o *ReportObserver) OnEndAlarms(count int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
 
+	o.report.AlarmsCount = count
+	o.alarms.AlarmsCount = count
+	o.alarms.End()
+	o.push(o.alarms)
 }
 
-func (o ReportObserver) OnEndAlarms() {
+func (o *ReportObserver) OnFiles(files []string) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.report.Files = files
+}
+
+// OnReject count the rows dropped by the parser of the step
+func (o *ReportObserver) OnReject(step string, count int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.reportOf(step).Rejected += count
+}
+
+func (o *ReportObserver) OnSaved(step string, count int) {}
+
+// OnRetry count the output calls retried after a transient error
+func (o *ReportObserver) OnRetry(attempt int, err error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	o.report.Retries++
+	o.push(o.report)
+}
+
+func (o *ReportObserver) reportOf(step string) *entity.Report {
+	switch entity.StepType(step) {
+	case entity.TypeSamples:
+		return o.samples
+	case entity.TypeAlarms:
+		return o.alarms
+	}
+	return o.report
+}
+
+// client build the final report sent to the client, aggregating all the errors
+func (o *ReportObserver) client(step string) *entity.Report {
+	client := o.report.Copy(entity.TypeClient)
+	client.Read = o.samples.Read
+	client.Progress = o.samples.Progress
+	client.Rejected = o.samples.Rejected + o.alarms.Rejected
+	for _, report := range []*entity.Report{o.report, o.samples, o.alarms} {
+		for s, err := range report.Errors {
+			client.Errors[s] = err
+		}
+		for s, err := range report.ParseErrors {
+			client.AddParseError(s, err)
+		}
+	}
+	client.AddSuccess(step)
+	if step == entity.StepCancel || client.HasError() {
+		client.Status = entity.StatusFailure
+	} else {
+		client.End()
+	}
+	return client
+}
 
+// push publish a snapshot of the report with the next sequential ID
+func (o *ReportObserver) push(report *entity.Report) {
+	o.report.Step()
+	snapshot := report.Clone()
+	snapshot.ID = o.report.ID
+	o.publisher.Publish(snapshot)
 }
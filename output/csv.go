@@ -2,27 +2,64 @@ package output
 
 import (
 	"encoding/csv"
+	"errors"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
-	"github.com/leaklessgfy/safran-server/utils"
-
 	"github.com/leaklessgfy/safran-server/entity"
 )
 
 type CSVOutput struct {
+	fileRoot
+	dir      string
 	file     *os.File
 	writer   *csv.Writer
-	date     time.Time
+	alarms   *os.File
+	appended fileSizes
 	measures []*entity.Measure
 }
 
-func NewCSVOutput(file *os.File) *CSVOutput {
-	return &CSVOutput{file: file, writer: csv.NewWriter(file)}
+// NewCSVOutput create a csv output writing in root/{experimentID}/samples.csv
+func NewCSVOutput(root string) *CSVOutput {
+	return &CSVOutput{fileRoot: fileRoot{root}}
 }
 
 func (o *CSVOutput) SaveExperiment(experiment *entity.Experiment) error {
-	o.date = experiment.StartDate
+	return o.open(experiment, os.O_TRUNC)
+}
+
+// Append reopen the files of the experiment to write after their content
+func (o *CSVOutput) Append(experiment *entity.Experiment) error {
+	dir := o.experimentDir(experiment.ID)
+	appended, err := statSizes(filepath.Join(dir, "samples.csv"), filepath.Join(dir, "alarms.csv"))
+	if err != nil {
+		return err
+	}
+	err = o.open(experiment, os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	o.appended = appended
+	o.alarms, err = os.OpenFile(filepath.Join(o.dir, "alarms.csv"), os.O_WRONLY|os.O_APPEND, 0666)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (o *CSVOutput) open(experiment *entity.Experiment, flag int) error {
+	o.dir = o.experimentDir(experiment.ID)
+	err := os.MkdirAll(o.dir, 0777)
+	if err != nil {
+		return err
+	}
+	o.file, err = os.OpenFile(filepath.Join(o.dir, "samples.csv"), os.O_WRONLY|os.O_CREATE|flag, 0666)
+	if err != nil {
+		return err
+	}
+	o.writer = csv.NewWriter(o.file)
 	return nil
 }
 
@@ -44,22 +81,60 @@ func (o CSVOutput) SaveSamples(samples []*entity.Sample) error {
 	return o.writer.Error()
 }
 
-func (o CSVOutput) SaveAlarms([]*entity.Alarm) error {
-	return nil
+// SaveAlarms append the alarms to the companion alarms.csv
+func (o *CSVOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	var err error
+	if o.alarms == nil {
+		o.alarms, err = os.Create(filepath.Join(o.dir, "alarms.csv"))
+		if err != nil {
+			return err
+		}
+	}
+	var results [][]string
+	for _, alarm := range alarms {
+		results = append(results, []string{alarm.Time.Format(time.RFC3339Nano), strconv.Itoa(alarm.Level), alarm.Message})
+	}
+	writer := csv.NewWriter(o.alarms)
+	err = writer.WriteAll(results)
+	if err != nil {
+		return err
+	}
+	return writer.Error()
 }
 
+// Cancel delete the files, or cut them back to their content before the import when it appended to them
 func (o CSVOutput) Cancel() error {
-	err := o.file.Close()
-	if err != nil {
-		return err
+	if o.file == nil {
+		return nil
+	}
+	o.file.Close()
+	if o.alarms != nil {
+		o.alarms.Close()
+	}
+	if o.appended != nil {
+		return o.appended.restore()
 	}
-	return os.Remove(o.file.Name())
+	return os.RemoveAll(o.dir)
 }
 
 func (o CSVOutput) End() error {
+	if o.alarms != nil {
+		err := o.alarms.Close()
+		if err != nil {
+			return err
+		}
+	}
 	return o.file.Close()
 }
 
+func (o CSVOutput) Files() []string {
+	files := []string{"samples.csv"}
+	if o.alarms != nil {
+		files = append(files, "alarms.csv")
+	}
+	return files
+}
+
 func (o CSVOutput) normalizeSamples(samples []*entity.Sample) ([][]string, error) {
 	var results [][]string
 
@@ -76,18 +151,16 @@ func (o CSVOutput) normalizeSamples(samples []*entity.Sample) ([][]string, error
 
 func (o CSVOutput) normalizeSample(sample *entity.Sample) ([]string, error) {
 	var result []string
-	measure := o.measures[sample.Inc]
-	t, err := utils.ParseTime(sample.Time, o.date)
-
-	if err != nil {
-		return nil, err
+	if sample.Inc >= len(o.measures) {
+		return nil, errors.New("sample index > measures length, index=" + strconv.Itoa(sample.Inc) + ", length=" + strconv.Itoa(len(o.measures)))
 	}
+	measure := o.measures[sample.Inc]
 
-	result = append(result, t.Format(time.RFC3339Nano)) // Bad format
+	result = append(result, sample.Time.Format(time.RFC3339Nano))
 	result = append(result, measure.Name)
 	result = append(result, measure.Typex)
 	result = append(result, measure.Unitx)
-	result = append(result, sample.Value)
+	result = append(result, entity.FormatValue(sample.Value))
 
 	return result, nil
 }
@@ -8,6 +8,14 @@ func (o EmptyOutput) SaveExperiment(*entity.Experiment) error {
 	return nil
 }
 
+func (o EmptyOutput) Append(*entity.Experiment) error {
+	return nil
+}
+
+func (o EmptyOutput) Remove(string) error {
+	return nil
+}
+
 func (o EmptyOutput) SaveMeasures([]*entity.Measure) error {
 	return nil
 }
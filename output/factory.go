@@ -2,21 +2,26 @@ package output
 
 import (
 	"errors"
-	"os"
+
+	"github.com/leaklessgfy/safran-server/config"
 )
 
-func NewOutput(key string) (Output, error) {
+func NewOutput(key string, conf *config.Config) (Output, error) {
 	switch key {
 	case "csv":
-		file, err := os.Create("./csv/result.csv")
-		if err != nil {
-			return nil, err
-		}
-		return NewCSVOutput(file), nil
+		return NewCSVOutput(conf.Output.Dir), nil
 	case "json":
-		return &JSONOutput{}, nil
+		return NewJSONOutput(conf.Output.Dir), nil
 	case "influx":
-		return NewInfluxOutput()
+		return NewInfluxOutput(conf.Influx)
+	case "influx2":
+		return NewInflux2Output(conf.Influx2)
+	case "parquet":
+		return NewParquetOutput(conf.Output.Dir), nil
+	case "sql":
+		return NewSQLOutput(conf.SQL)
+	case "lineprotocol":
+		return NewLineProtocolOutput(conf.Output.Dir, conf.Influx), nil
 	case "fake":
 		return &EmptyOutput{}, nil
 	}
@@ -1,143 +1,257 @@
 package output
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"strconv"
 	"time"
 
 	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/leaklessgfy/safran-server/config"
 	"github.com/leaklessgfy/safran-server/entity"
-	"github.com/leaklessgfy/safran-server/utils"
 	uuid "github.com/satori/go.uuid"
 )
 
-const (
-	DB        = "safran_db"
-	PRECISION = "ms"
-)
-
 type InfluxOutput struct {
-	c            client.Client
-	experimentID string
-	date         time.Time
-	measuresID   []string
+	influxImport
+	c         client.Client
+	database  string
+	precision string
+	retry     *retrier
+	ctx       context.Context
 }
 
-func NewInfluxOutput() (*InfluxOutput, error) {
+func NewInfluxOutput(conf config.InfluxConfig) (*InfluxOutput, error) {
+	tlsConfig, err := buildTLSConfig(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
 	c, err := client.NewHTTPClient(client.HTTPConfig{
-		Addr: "http://localhost:8086",
+		Addr:               conf.URL,
+		Username:           conf.Username,
+		Password:           conf.Password,
+		Timeout:            conf.Timeout.Duration,
+		InsecureSkipVerify: conf.TLS.Insecure,
+		TLSConfig:          tlsConfig,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &InfluxOutput{c: c}, nil
+	return &InfluxOutput{c: c, database: conf.Database, precision: conf.Precision, retry: newRetrier(conf.Retry), ctx: context.Background()}, nil
+}
+
+// SetContext stop retrying the writes once ctx is done, the deletes of a rollback are still retried
+func (o *InfluxOutput) SetContext(ctx context.Context) {
+	o.ctx = ctx
+}
+
+// OnRetry set the callback told of each retried write or query
+func (o *InfluxOutput) OnRetry(callback func(attempt int, err error)) {
+	o.retry.onRetry = callback
 }
 
 func (o *InfluxOutput) SaveExperiment(experiment *entity.Experiment) error {
-	batchPoints, err := buildBatchPoints()
+	return o.saveExperiment(o, experiment)
+}
+
+// Append save the experiment again, the points of an experiment having the same ids they are overwritten,
+// the samples and alarms are tagged with an import id so a cancel deletes only them
+func (o *InfluxOutput) Append(experiment *entity.Experiment) error {
+	return o.appendExperiment(o, experiment)
+}
+
+// Remove delete the points of a previous import of the experiment
+func (o InfluxOutput) Remove(experimentID string) error {
+	return removeExperiment(o, experimentID)
+}
+
+func (o *InfluxOutput) SaveMeasures(measures []*entity.Measure) error {
+	return o.saveMeasures(o, measures)
+}
+
+func (o *InfluxOutput) SaveSamples(samples []*entity.Sample) error {
+	return o.saveSamples(o, samples)
+}
+
+func (o *InfluxOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	return o.saveAlarms(o, alarms)
+}
+
+// Cancel delete the points of the experiment, or only the samples and alarms written when the import appended to it
+func (o InfluxOutput) Cancel() error {
+	err := o.cancel(o)
 	if err != nil {
 		return err
 	}
+	return o.End()
+}
+
+func (o InfluxOutput) End() error {
+	return o.c.Close()
+}
+
+func (o InfluxOutput) writePoints(points []*client.Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	batchPoints, err := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:  o.database,
+		Precision: o.precision,
+	})
+	if err != nil {
+		return err
+	}
+	batchPoints.AddPoints(points)
+	return o.retry.do(o.ctx, func() error {
+		return o.c.Write(batchPoints)
+	})
+}
+
+func (o InfluxOutput) deletePoints(measurement, tag, value string) error {
+	query := client.NewQuery(fmt.Sprintf(`DELETE FROM %s WHERE "%s"='%s'`, measurement, tag, value), o.database, o.precision)
+	return o.retry.do(context.Background(), func() error {
+		response, err := o.c.Query(query)
+		if err != nil {
+			return err
+		}
+		return response.Error()
+	})
+}
+
+// pointWriter is an output saving influx points
+type pointWriter interface {
+	writePoints(points []*client.Point) error
+}
+
+// pointDeleter is an output deleting the influx points of a measurement having a tag value
+type pointDeleter interface {
+	deletePoints(measurement, tag, value string) error
+}
+
+// influxImport build the points of an import, shared by the outputs writing influx points
+type influxImport struct {
+	experimentID string
+	startDate    time.Time
+	measuresID   []string
+	importID     string
+}
+
+func (i *influxImport) saveExperiment(w pointWriter, experiment *entity.Experiment) error {
 	id, point, err := buildExperimentPoint(experiment)
 	if err != nil {
 		return err
 	}
-	batchPoints.AddPoint(point)
-	err = o.c.Write(batchPoints)
+	err = w.writePoints([]*client.Point{point})
 	if err != nil {
 		return err
 	}
-	o.experimentID = id
-	o.date = experiment.StartDate
+	i.experimentID = id
+	i.startDate = experiment.StartDate
 	return nil
 }
 
-func (o *InfluxOutput) SaveMeasures(measures []*entity.Measure) error {
-	batchPoints, err := buildBatchPoints()
+// appendExperiment save the experiment and tag the next samples and alarms with a new import id
+func (i *influxImport) appendExperiment(w pointWriter, experiment *entity.Experiment) error {
+	err := i.saveExperiment(w, experiment)
 	if err != nil {
 		return err
 	}
+	i.importID = uuid.NewV4().String()
+	return nil
+}
+
+func (i *influxImport) saveMeasures(w pointWriter, measures []*entity.Measure) error {
+	points := make([]*client.Point, 0, len(measures))
+	i.measuresID = nil
 	for _, measure := range measures {
-		id, point, err := buildMeasurePoint(o.experimentID, measure)
+		id, point, err := buildMeasurePoint(i.experimentID, i.startDate, measure)
 		if err != nil {
 			return err
 		}
-		batchPoints.AddPoint(point)
-		o.measuresID = append(o.measuresID, id)
+		points = append(points, point)
+		i.measuresID = append(i.measuresID, id)
 	}
-	return o.c.Write(batchPoints)
+	return w.writePoints(points)
 }
 
-func (o InfluxOutput) SaveSamples(samples []*entity.Sample) error {
-	batchPoints, err := buildBatchPoints()
-	if err != nil {
-		return err
-	}
+func (i influxImport) saveSamples(w pointWriter, samples []*entity.Sample) error {
+	points := make([]*client.Point, 0, len(samples))
 	for _, sample := range samples {
-		point, err := buildSamplePoint(o.experimentID, o.measuresID[sample.Inc], o.date, sample)
+		point, err := buildSamplePoint(i.experimentID, i.measuresID[sample.Inc], i.importID, sample)
 		if err != nil {
 			return err
 		}
-		batchPoints.AddPoint(point)
+		points = append(points, point)
 	}
-	return o.c.Write(batchPoints)
+	return w.writePoints(points)
 }
 
-func (o InfluxOutput) SaveAlarms(alarms []*entity.Alarm) error {
-	batchPoints, err := buildBatchPoints()
-	if err != nil {
-		return err
-	}
+func (i influxImport) saveAlarms(w pointWriter, alarms []*entity.Alarm) error {
+	points := make([]*client.Point, 0, len(alarms))
 	for _, alarm := range alarms {
-		point, err := buildAlarmPoint(o.experimentID, o.date, alarm)
+		point, err := buildAlarmPoint(i.experimentID, i.importID, alarm)
 		if err != nil {
 			return err
 		}
-		batchPoints.AddPoint(point)
+		points = append(points, point)
 	}
-	return o.c.Write(batchPoints)
+	return w.writePoints(points)
 }
 
-func (o InfluxOutput) Cancel() error {
-	var queries []client.Query
-
-	query1 := client.NewQuery(fmt.Sprintf(`DELETE FROM experiments WHERE "id"='%s'`, o.experimentID), DB, PRECISION)
-	query2 := client.NewQuery(fmt.Sprintf(`DELETE FROM measures WHERE "experimentID"='%s'`, o.experimentID), DB, PRECISION)
-	query3 := client.NewQuery(fmt.Sprintf(`DELETE FROM samples WHERE "experimentID"='%s'`, o.experimentID), DB, PRECISION)
-	query4 := client.NewQuery(fmt.Sprintf(`DELETE FROM alarms WHERE "experimentID"='%s'`, o.experimentID), DB, PRECISION)
-
-	queries = append(queries, query1)
-	queries = append(queries, query2)
-	queries = append(queries, query3)
-	queries = append(queries, query4)
-
-	for _, query := range queries {
-		response, err := o.c.Query(query)
+// cancel delete the points of the experiment, or only the samples and alarms tagged with the import id,
+// the experiment and measures points of an append being the ones of the previous import
+func (i influxImport) cancel(d pointDeleter) error {
+	if i.importID == "" {
+		return removeExperiment(d, i.experimentID)
+	}
+	for _, measurement := range []string{"samples", "alarms"} {
+		err := d.deletePoints(measurement, "importID", i.importID)
 		if err != nil {
 			return err
 		}
-		if response.Error() != nil {
-			return response.Error()
-		}
 	}
-
-	return o.End()
+	return nil
 }
 
-func (o InfluxOutput) End() error {
-	return o.c.Close()
+// removeExperiment delete the points of each measurement of the experiment
+func removeExperiment(d pointDeleter, experimentID string) error {
+	deletes := [][2]string{
+		{"experiments", "id"},
+		{"measures", "experimentID"},
+		{"samples", "experimentID"},
+		{"alarms", "experimentID"},
+	}
+	for _, del := range deletes {
+		err := d.deletePoints(del[0], del[1], experimentID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func buildBatchPoints() (client.BatchPoints, error) {
-	return client.NewBatchPoints(client.BatchPointsConfig{
-		Database:  DB,
-		Precision: PRECISION,
-	})
+func buildTLSConfig(conf config.TLSConfig) (*tls.Config, error) {
+	if conf.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := ioutil.ReadFile(conf.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificate found in " + conf.CAFile)
+	}
+	return &tls.Config{RootCAs: pool, InsecureSkipVerify: conf.Insecure}, nil
 }
 
 func buildExperimentPoint(experiment *entity.Experiment) (string, *client.Point, error) {
-	id := uuid.NewV4()
 	tags := map[string]string{
-		"id": id.String(),
+		"id": experiment.ID,
 	}
 	fields := map[string]interface{}{
 		"reference": experiment.Reference,
@@ -148,13 +262,14 @@ func buildExperimentPoint(experiment *entity.Experiment) (string, *client.Point,
 		"endDate":   experiment.EndDate.UnixNano() / 1000000,
 	}
 	point, err := client.NewPoint("experiments", tags, fields, experiment.StartDate)
-	return id.String(), point, err
+	return experiment.ID, point, err
 }
 
-func buildMeasurePoint(experimentID string, measure *entity.Measure) (string, *client.Point, error) {
-	id := uuid.NewV4()
+// buildMeasurePoint derive the measure id and time from the experiment, so importing the experiment again overwrites its points
+func buildMeasurePoint(experimentID string, startDate time.Time, measure *entity.Measure) (string, *client.Point, error) {
+	id := measureID(experimentID, measure)
 	tags := map[string]string{
-		"id":           id.String(),
+		"id":           id,
 		"experimentID": experimentID,
 	}
 	fields := map[string]interface{}{
@@ -162,36 +277,55 @@ func buildMeasurePoint(experimentID string, measure *entity.Measure) (string, *c
 		"type": measure.Typex,
 		"unit": measure.Unitx,
 	}
-	point, err := client.NewPoint("measures", tags, fields, time.Now())
-	return id.String(), point, err
+	point, err := client.NewPoint("measures", tags, fields, startDate)
+	return id, point, err
+}
+
+// measureID return the id of a measure, the same for each import of the experiment
+func measureID(experimentID string, measure *entity.Measure) string {
+	return uuid.NewV5(uuid.FromStringOrNil(experimentID), strconv.Itoa(measure.Inc)+"/"+measure.Name).String()
 }
 
-func buildSamplePoint(experimentID, measureID string, experimentDate time.Time, sample *entity.Sample) (*client.Point, error) {
+// buildSamplePoint create the point of a sample, importID tagging the samples appended to an experiment
+func buildSamplePoint(experimentID, measureID, importID string, sample *entity.Sample) (*client.Point, error) {
 	tags := map[string]string{
 		"experimentID": experimentID,
 		"measureID":    measureID,
 	}
+	if importID != "" {
+		tags["importID"] = importID
+	}
+	field, value := sampleField(sample.Value)
 	fields := map[string]interface{}{
-		"value": sample.Value,
+		field: value,
 	}
-	date, err := utils.ParseTime(sample.Time, experimentDate)
-	if err != nil {
-		return nil, err
+	return client.NewPoint("samples", tags, fields, sample.Time)
+}
+
+// sampleField return the field holding a sample value, influx forbids mixing types in a field of a measurement,
+// the numbers stay floats in value so the integer measures are read along the others
+func sampleField(value interface{}) (string, interface{}) {
+	switch v := value.(type) {
+	case int64:
+		return "value", float64(v)
+	case bool:
+		return "valueBool", v
+	case string:
+		return "valueString", v
 	}
-	return client.NewPoint("samples", tags, fields, date)
+	return "value", value
 }
 
-func buildAlarmPoint(experimentID string, experimentDate time.Time, alarm *entity.Alarm) (*client.Point, error) {
+func buildAlarmPoint(experimentID, importID string, alarm *entity.Alarm) (*client.Point, error) {
 	tags := map[string]string{
 		"experimentID": experimentID,
 	}
+	if importID != "" {
+		tags["importID"] = importID
+	}
 	fields := map[string]interface{}{
 		"level":   alarm.Level,
 		"message": alarm.Message,
 	}
-	date, err := utils.ParseTime(alarm.Time, experimentDate)
-	if err != nil {
-		return nil, err
-	}
-	return client.NewPoint("alarms", tags, fields, date)
+	return client.NewPoint("alarms", tags, fields, alarm.Time)
 }
@@ -0,0 +1,197 @@
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// Influx2Output save the points of the influx output in a bucket of an influx 2.x server,
+// through the v2 write and delete HTTP APIs
+type Influx2Output struct {
+	influxImport
+	c         *http.Client
+	url       string
+	org       string
+	bucket    string
+	token     string
+	precision string
+	retry     *retrier
+	ctx       context.Context
+}
+
+func NewInflux2Output(conf config.Influx2Config) (*Influx2Output, error) {
+	tlsConfig, err := buildTLSConfig(conf.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && conf.TLS.Insecure {
+		tlsConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	return &Influx2Output{
+		c:         &http.Client{Timeout: conf.Timeout.Duration, Transport: transport},
+		url:       strings.TrimSuffix(conf.URL, "/"),
+		org:       conf.Org,
+		bucket:    conf.Bucket,
+		token:     conf.Token,
+		precision: conf.Precision,
+		retry:     newRetrier(conf.Retry),
+		ctx:       context.Background(),
+	}, nil
+}
+
+// SetContext abort the writes once ctx is done, the deletes of a rollback are still sent
+func (o *Influx2Output) SetContext(ctx context.Context) {
+	o.ctx = ctx
+}
+
+// OnRetry set the callback told of each retried write or delete
+func (o *Influx2Output) OnRetry(callback func(attempt int, err error)) {
+	o.retry.onRetry = callback
+}
+
+func (o *Influx2Output) SaveExperiment(experiment *entity.Experiment) error {
+	return o.saveExperiment(o, experiment)
+}
+
+// Append save the experiment again, the points of an experiment having the same ids they are overwritten,
+// the samples and alarms are tagged with an import id so a cancel deletes only them
+func (o *Influx2Output) Append(experiment *entity.Experiment) error {
+	return o.appendExperiment(o, experiment)
+}
+
+// Remove delete the points of a previous import of the experiment
+func (o Influx2Output) Remove(experimentID string) error {
+	return removeExperiment(o, experimentID)
+}
+
+func (o *Influx2Output) SaveMeasures(measures []*entity.Measure) error {
+	return o.saveMeasures(o, measures)
+}
+
+func (o *Influx2Output) SaveSamples(samples []*entity.Sample) error {
+	return o.saveSamples(o, samples)
+}
+
+func (o *Influx2Output) SaveAlarms(alarms []*entity.Alarm) error {
+	return o.saveAlarms(o, alarms)
+}
+
+// Cancel delete the points of the experiment, or only the samples and alarms written when the import appended to it
+func (o Influx2Output) Cancel() error {
+	err := o.cancel(o)
+	if err != nil {
+		return err
+	}
+	return o.End()
+}
+
+func (o Influx2Output) End() error {
+	o.c.CloseIdleConnections()
+	return nil
+}
+
+// writePoints send the points gzipped in line protocol to /api/v2/write
+func (o Influx2Output) writePoints(points []*client.Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	precision := linePrecision(o.precision)
+	for _, point := range points {
+		_, err := io.WriteString(writer, point.PrecisionString(precision)+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"org": {o.org}, "bucket": {o.bucket}, "precision": {o.precision}}
+	return o.retry.do(o.ctx, func() error {
+		request, err := http.NewRequest(http.MethodPost, o.url+"/api/v2/write?"+query.Encode(), bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return err
+		}
+		request = request.WithContext(o.ctx)
+		request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		request.Header.Set("Content-Encoding", "gzip")
+		return o.do(request)
+	})
+}
+
+// deletePoints remove the points of the measurement having the tag value from /api/v2/delete, whatever their time,
+// the delete predicates can't be combined with OR
+func (o Influx2Output) deletePoints(measurement, tag, value string) error {
+	predicate := fmt.Sprintf(`_measurement="%s" AND %s="%s"`, measurement, tag, value)
+	body, err := json.Marshal(map[string]string{
+		"start":     time.Unix(0, 0).UTC().Format(time.RFC3339Nano),
+		"stop":      time.Unix(0, math.MaxInt64).UTC().Format(time.RFC3339Nano),
+		"predicate": predicate,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"org": {o.org}, "bucket": {o.bucket}}
+	return o.retry.do(context.Background(), func() error {
+		request, err := http.NewRequest(http.MethodPost, o.url+"/api/v2/delete?"+query.Encode(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		return o.do(request)
+	})
+}
+
+// do send the request with the token, the errors keeping the status code so the 5xx are retried
+func (o Influx2Output) do(request *http.Request) error {
+	if o.token != "" {
+		request.Header.Set("Authorization", "Token "+o.token)
+	}
+	response, err := o.c.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	var influxErr struct {
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &influxErr) == nil && influxErr.Message != "" {
+		message = influxErr.Message
+	}
+	return fmt.Errorf("influx2 %s failed, status %d: %s", request.URL.Path, response.StatusCode, message)
+}
+
+// linePrecision return the v1 precision of a v2 precision, the microseconds being u in v1
+func linePrecision(precision string) string {
+	if precision == "us" {
+		return "u"
+	}
+	return precision
+}
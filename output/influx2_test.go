@@ -0,0 +1,313 @@
+package output
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// influx2Request is a request received by the stand-in server, the body being uncompressed
+type influx2Request struct {
+	path     string
+	query    map[string]string
+	token    string
+	encoding string
+	body     string
+}
+
+// influx2Server stand in for an influx 2.x server, answering the first failures requests with status
+type influx2Server struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []influx2Request
+	failures int
+	status   int
+}
+
+func newInflux2Server(t *testing.T, failures, status int) *influx2Server {
+	s := &influx2Server{failures: failures, status: status}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := influx2Request{
+			path:     r.URL.Path,
+			query:    map[string]string{},
+			token:    r.Header.Get("Authorization"),
+			encoding: r.Header.Get("Content-Encoding"),
+		}
+		for key := range r.URL.Query() {
+			request.query[key] = r.URL.Query().Get(key)
+		}
+		body, err := readBody(r)
+		if err != nil {
+			t.Error(err)
+		}
+		request.body = body
+
+		s.lock.Lock()
+		s.requests = append(s.requests, request)
+		fail := s.failures > 0
+		if fail {
+			s.failures--
+		}
+		s.lock.Unlock()
+
+		if fail {
+			w.WriteHeader(s.status)
+			w.Write([]byte(`{"code":"error","message":"failure"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return s
+}
+
+func readBody(r *http.Request) (string, error) {
+	reader := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return "", err
+		}
+		reader = gz
+	}
+	b, err := ioutil.ReadAll(reader)
+	return string(b), err
+}
+
+func (s *influx2Server) received() []influx2Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]influx2Request(nil), s.requests...)
+}
+
+func newTestInflux2Output(t *testing.T, url string) *Influx2Output {
+	o, err := NewInflux2Output(config.Influx2Config{
+		URL:       url,
+		Org:       "safran",
+		Bucket:    "bench",
+		Token:     "secret",
+		Precision: "ms",
+		Timeout:   config.Duration{Duration: 5 * time.Second},
+		Retry:     config.RetryConfig{Attempts: 3, Delay: config.Duration{Duration: time.Millisecond}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+var testExperiment = &entity.Experiment{
+	ID:        "da03fb82-84a9-5881-9318-8c6f668f50b0",
+	Reference: "t",
+	Name:      "test",
+	Bench:     "b",
+	Campaign:  "c",
+	StartDate: time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC),
+	EndDate:   time.Date(2019, time.January, 21, 15, 5, 0, 0, time.UTC),
+}
+
+func TestInflux2Write(t *testing.T) {
+	server := newInflux2Server(t, 0, 0)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL+"/")
+
+	sampleTime := time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC)
+	calls := []func() error{
+		func() error { return o.SaveExperiment(testExperiment) },
+		func() error {
+			return o.SaveMeasures([]*entity.Measure{{Name: "pressure", Typex: "D32", Unitx: "mBar", Type: entity.ValueFloat, Inc: 0}})
+		},
+		func() error { return o.SaveSamples([]*entity.Sample{{Time: sampleTime, Value: 1011.078125, Inc: 0}}) },
+		func() error {
+			return o.SaveAlarms([]*entity.Alarm{{Time: sampleTime, Level: 1, Message: "Start black box recording"}})
+		},
+		o.End,
+	}
+	for _, call := range calls {
+		err := call()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := server.received()
+	if len(requests) != 4 {
+		t.Fatalf("%d requests, expected 4", len(requests))
+	}
+	measurements := []string{"experiments,", "measures,", "samples,", "alarms,"}
+	for i, request := range requests {
+		if request.path != "/api/v2/write" {
+			t.Errorf("request %d to %s, expected /api/v2/write", i, request.path)
+		}
+		if request.token != "Token secret" {
+			t.Errorf("request %d authorization %q, expected the token", i, request.token)
+		}
+		if request.encoding != "gzip" {
+			t.Errorf("request %d encoding %q, expected gzip", i, request.encoding)
+		}
+		if request.query["org"] != "safran" || request.query["bucket"] != "bench" || request.query["precision"] != "ms" {
+			t.Errorf("request %d query %v", i, request.query)
+		}
+		if !strings.HasPrefix(request.body, measurements[i]) {
+			t.Errorf("request %d body %q, expected %s points", i, request.body, measurements[i])
+		}
+	}
+	if !strings.Contains(requests[2].body, "value=1011.078125 1548081117700\n") {
+		t.Errorf("samples body %q, expected the value at the time in milliseconds", requests[2].body)
+	}
+}
+
+func TestInflux2Remove(t *testing.T) {
+	server := newInflux2Server(t, 0, 0)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+
+	err := o.Remove(testExperiment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := server.received()
+	if len(requests) != 4 {
+		t.Fatalf("%d requests, expected a delete per measurement", len(requests))
+	}
+	for _, request := range requests {
+		if request.path != "/api/v2/delete" || request.token != "Token secret" {
+			t.Errorf("request to %s with authorization %q", request.path, request.token)
+		}
+		var body map[string]string
+		err := json.Unmarshal([]byte(request.body), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body["start"] != "1970-01-01T00:00:00Z" || !strings.Contains(body["predicate"], testExperiment.ID) {
+			t.Errorf("delete body %v", body)
+		}
+	}
+}
+
+func TestInflux2CancelAppended(t *testing.T) {
+	server := newInflux2Server(t, 0, 0)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+
+	err := o.Append(testExperiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.SaveMeasures([]*entity.Measure{{Name: "pressure", Type: entity.ValueFloat}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2019, time.January, 21, 14, 40, 0, 0, time.UTC)
+	err = o.SaveSamples([]*entity.Sample{{Time: first.Add(time.Second), Value: 1.0}, {Time: first, Value: 2.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = o.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := server.received()
+	if !strings.Contains(requests[2].body, "importID="+o.importID) {
+		t.Errorf("samples body %q, expected the import id tag", requests[2].body)
+	}
+	deletes := requests[3:]
+	if len(deletes) != 2 {
+		t.Fatalf("%d requests, expected the deletes of the appended samples and alarms", len(requests))
+	}
+	for i, measurement := range []string{"samples", "alarms"} {
+		var body map[string]string
+		err = json.Unmarshal([]byte(deletes[i].body), &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		predicate := `_measurement="` + measurement + `" AND importID="` + o.importID + `"`
+		if deletes[i].path != "/api/v2/delete" || body["predicate"] != predicate {
+			t.Errorf("delete %s with %v, expected the points of the import only", deletes[i].path, body)
+		}
+	}
+}
+
+func TestInflux2Retry(t *testing.T) {
+	server := newInflux2Server(t, 2, http.StatusServiceUnavailable)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+	var attempts []int
+	o.OnRetry(func(attempt int, err error) {
+		attempts = append(attempts, attempt)
+	})
+
+	err := o.SaveExperiment(testExperiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.received()) != 3 || len(attempts) != 2 {
+		t.Errorf("%d requests and retries %v, expected the write sent 3 times", len(server.received()), attempts)
+	}
+}
+
+func TestInflux2RetryGivesUp(t *testing.T) {
+	server := newInflux2Server(t, 5, http.StatusInternalServerError)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+
+	err := o.SaveExperiment(testExperiment)
+	if err == nil || !strings.Contains(err.Error(), "status 500: failure") {
+		t.Fatalf("error %v, expected the status and message of the server", err)
+	}
+	if len(server.received()) != 3 {
+		t.Errorf("%d requests, expected the 3 attempts", len(server.received()))
+	}
+}
+
+func TestInflux2NoRetryOnClientError(t *testing.T) {
+	server := newInflux2Server(t, 1, http.StatusBadRequest)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+
+	err := o.SaveExperiment(testExperiment)
+	if err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Fatalf("error %v, expected the bad request", err)
+	}
+	if len(server.received()) != 1 {
+		t.Errorf("%d requests, expected no retry", len(server.received()))
+	}
+}
+
+func TestInflux2NoRetryOnceCancelled(t *testing.T) {
+	server := newInflux2Server(t, 5, http.StatusServiceUnavailable)
+	defer server.Close()
+	o := newTestInflux2Output(t, server.URL)
+	o.retry.delay = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	o.SetContext(ctx)
+	o.OnRetry(func(attempt int, err error) {
+		cancel()
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- o.SaveExperiment(testExperiment)
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("the write succeeded, expected the error of the server")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the write is still retried after the cancel")
+	}
+	if len(server.received()) != 1 {
+		t.Errorf("%d requests, expected no retry once cancelled", len(server.received()))
+	}
+}
@@ -0,0 +1,34 @@
+package output
+
+import (
+	"testing"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+func TestBuildSamplePoint(t *testing.T) {
+	sampleTime := time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC)
+	tests := []struct {
+		name  string
+		value interface{}
+		line  string
+	}{
+		{"float", 1011.078125, "value=1011.078125"},
+		{"integer stays in value", int64(42), "value=42"},
+		{"bool", true, "valueBool=true"},
+		{"string", "on", `valueString="on"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			point, err := buildSamplePoint("e", "m", "", &entity.Sample{Time: sampleTime, Value: test.value})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := "samples,experimentID=e,measureID=m " + test.line + " 1548081117700"
+			if line := point.PrecisionString("ms"); line != expected {
+				t.Errorf("point %q, expected %q", line, expected)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"time"
@@ -13,27 +14,30 @@ import (
 )
 
 type JSONOutput struct {
-	date    time.Time
+	fileRoot
+	dir     string
 	length  int
 	buffers [][]byte
+	alarms  []jsonAlarm
 	group   *sync.WaitGroup
 }
 
+// NewJSONOutput create a json output writing in root/{experimentID}/measures/{inc}.json
+func NewJSONOutput(root string) *JSONOutput {
+	return &JSONOutput{fileRoot: fileRoot{root}}
+}
+
 func (o *JSONOutput) SaveExperiment(experiment *entity.Experiment) error {
-	o.date = experiment.StartDate
 	o.group = &sync.WaitGroup{}
-	err := os.RemoveAll("./dumps")
-	if err != nil {
-		return err
-	}
-	return os.Mkdir("./dumps", 0777)
+	o.dir = o.experimentDir(experiment.ID)
+	return os.MkdirAll(filepath.Join(o.dir, "measures"), 0777)
 }
 
 func (o *JSONOutput) SaveMeasures(measures []*entity.Measure) error {
 	o.length = len(measures)
 	o.buffers = make([][]byte, o.length)
 	for _, measure := range measures {
-		f, err := os.Create("./dumps/" + strconv.Itoa(measure.Inc) + ".json")
+		f, err := os.Create(o.path(measure.Inc))
 		if err != nil {
 			return err
 		}
@@ -50,8 +54,8 @@ func (o *JSONOutput) SaveMeasures(measures []*entity.Measure) error {
 func (o *JSONOutput) SaveSamples(samples []*entity.Sample) error {
 	for _, sample := range samples {
 		b, err := json.Marshal(struct {
-			Time  string `json:"time"`
-			Value string `json:"value"`
+			Time  time.Time   `json:"time"`
+			Value interface{} `json:"value"`
 		}{
 			Time:  sample.Time,
 			Value: sample.Value,
@@ -69,13 +73,13 @@ func (o *JSONOutput) SaveSamples(samples []*entity.Sample) error {
 	for key, buffer := range o.buffers {
 		if len(buffer) > 1000 {
 			o.group.Add(1)
-			go func() {
-				err := flushBuffer(key, buffer)
+			go func(path string, buffer []byte) {
+				err := flushBuffer(path, buffer)
 				if err != nil {
 					log.Println("[CONCURRENT]", err)
 				}
 				o.group.Done()
-			}()
+			}(o.path(key), buffer)
 			keys = append(keys, key)
 		}
 	}
@@ -87,18 +91,50 @@ func (o *JSONOutput) SaveSamples(samples []*entity.Sample) error {
 	return nil
 }
 
-func (o JSONOutput) SaveAlarms([]*entity.Alarm) error {
+type jsonAlarm struct {
+	Time    string `json:"time"`
+	Level   int    `json:"level"`
+	Message string `json:"message"`
+}
+
+// SaveAlarms keep the alarms until End writes them in alarms.json
+func (o *JSONOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	for _, alarm := range alarms {
+		o.alarms = append(o.alarms, jsonAlarm{
+			Time:    alarm.Time.Format(time.RFC3339Nano),
+			Level:   alarm.Level,
+			Message: alarm.Message,
+		})
+	}
 	return nil
 }
 
 func (o JSONOutput) Cancel() error {
-	return os.RemoveAll("./dumps")
+	if o.dir == "" {
+		return nil
+	}
+	if o.group != nil {
+		o.group.Wait()
+	}
+	return os.RemoveAll(o.dir)
 }
 
 func (o JSONOutput) End() error {
 	o.group.Wait()
+	for key, buffer := range o.buffers {
+		if len(buffer) > 0 {
+			err := flushBuffer(o.path(key), buffer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := o.writeAlarms()
+	if err != nil {
+		return err
+	}
 	for i := 0; i < o.length; i++ {
-		f, err := os.OpenFile("./dumps/"+strconv.Itoa(i)+".json", os.O_RDWR, 0777)
+		f, err := os.OpenFile(o.path(i), os.O_RDWR, 0777)
 		if err != nil {
 			return err
 		}
@@ -124,8 +160,42 @@ func (o JSONOutput) End() error {
 	return nil
 }
 
-func flushBuffer(index int, buffer []byte) error {
-	f, err := os.OpenFile("./dumps/"+strconv.Itoa(index)+".json", os.O_WRONLY|os.O_APPEND, 0777)
+// Files return the measures directory, holding a file per measure, and alarms.json
+func (o JSONOutput) Files() []string {
+	var files []string
+	if o.length > 0 {
+		files = append(files, "measures")
+	}
+	if o.alarms != nil {
+		files = append(files, "alarms.json")
+	}
+	return files
+}
+
+func (o JSONOutput) writeAlarms() error {
+	if o.alarms == nil {
+		return nil
+	}
+	f, err := os.Create(o.alarmsPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(struct {
+		Alarms []jsonAlarm `json:"alarms"`
+	}{o.alarms})
+}
+
+func (o JSONOutput) alarmsPath() string {
+	return filepath.Join(o.dir, "alarms.json")
+}
+
+func (o JSONOutput) path(index int) string {
+	return filepath.Join(o.dir, "measures", strconv.Itoa(index)+".json")
+}
+
+func flushBuffer(path string, buffer []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0777)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,128 @@
+package output
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// LineProtocolOutput write the points of the influx output to root/{experimentID}/points.lp.gz,
+// the file is loaded later with: influx -import -compressed -path points.lp.gz -precision {precision}
+type LineProtocolOutput struct {
+	fileRoot
+	influxImport
+	database  string
+	precision string
+	dir       string
+	file      *os.File
+	gzip      *gzip.Writer
+	writer    *bufio.Writer
+	appended  fileSizes
+}
+
+// NewLineProtocolOutput create a line protocol output writing in root, the points going to the influx database of conf
+func NewLineProtocolOutput(root string, conf config.InfluxConfig) *LineProtocolOutput {
+	return &LineProtocolOutput{fileRoot: fileRoot{root}, database: conf.Database, precision: conf.Precision}
+}
+
+func (o *LineProtocolOutput) SaveExperiment(experiment *entity.Experiment) error {
+	err := o.open(experiment, os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	// the header of the influx import files
+	_, err = o.writer.WriteString("# DML\n# CONTEXT-DATABASE: " + o.database + "\n")
+	if err != nil {
+		return err
+	}
+	return o.saveExperiment(o, experiment)
+}
+
+// Append add a gzip member after the content of the file, the readers concatenating the members
+func (o *LineProtocolOutput) Append(experiment *entity.Experiment) error {
+	appended, err := statSizes(filepath.Join(o.experimentDir(experiment.ID), "points.lp.gz"))
+	if err != nil {
+		return err
+	}
+	err = o.open(experiment, os.O_APPEND)
+	if err != nil {
+		return err
+	}
+	o.appended = appended
+	return o.saveExperiment(o, experiment)
+}
+
+func (o *LineProtocolOutput) open(experiment *entity.Experiment, flag int) error {
+	o.dir = o.experimentDir(experiment.ID)
+	err := os.MkdirAll(o.dir, 0777)
+	if err != nil {
+		return err
+	}
+	o.file, err = os.OpenFile(filepath.Join(o.dir, "points.lp.gz"), os.O_WRONLY|os.O_CREATE|flag, 0666)
+	if err != nil {
+		return err
+	}
+	o.gzip = gzip.NewWriter(o.file)
+	o.writer = bufio.NewWriter(o.gzip)
+	return nil
+}
+
+func (o *LineProtocolOutput) SaveMeasures(measures []*entity.Measure) error {
+	return o.saveMeasures(o, measures)
+}
+
+func (o LineProtocolOutput) SaveSamples(samples []*entity.Sample) error {
+	return o.saveSamples(o, samples)
+}
+
+func (o LineProtocolOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	return o.saveAlarms(o, alarms)
+}
+
+// Cancel delete the file, or cut the gzip member the import appended to it
+func (o LineProtocolOutput) Cancel() error {
+	if o.file == nil {
+		return nil
+	}
+	o.file.Close()
+	if o.appended != nil {
+		return o.appended.restore()
+	}
+	return os.RemoveAll(o.dir)
+}
+
+func (o LineProtocolOutput) End() error {
+	err := o.writer.Flush()
+	if err != nil {
+		return err
+	}
+	err = o.gzip.Close()
+	if err != nil {
+		return err
+	}
+	return o.file.Close()
+}
+
+func (o LineProtocolOutput) Files() []string {
+	return []string{"points.lp.gz"}
+}
+
+// writePoints compress the points in the file, holding every saved batch if the server stops
+func (o LineProtocolOutput) writePoints(points []*client.Point) error {
+	for _, point := range points {
+		_, err := o.writer.WriteString(point.PrecisionString(o.precision) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	err := o.writer.Flush()
+	if err != nil {
+		return err
+	}
+	return o.gzip.Flush()
+}
@@ -0,0 +1,100 @@
+package output
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// saveLineProtocol write a measure, a sample of value and an alarm, saving the experiment with save
+func saveLineProtocol(t *testing.T, o *LineProtocolOutput, save func(*entity.Experiment) error, value float64) {
+	sampleTime := time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC)
+	calls := []func() error{
+		func() error { return save(testExperiment) },
+		func() error {
+			return o.SaveMeasures([]*entity.Measure{{Name: "pressure", Typex: "D32", Unitx: "mBar", Type: entity.ValueFloat}})
+		},
+		func() error { return o.SaveSamples([]*entity.Sample{{Time: sampleTime, Value: value}}) },
+		func() error {
+			return o.SaveAlarms([]*entity.Alarm{{Time: sampleTime, Level: 1, Message: "Start black box recording"}})
+		},
+		// End has a value receiver, it's bound once the file is open
+		func() error { return o.End() },
+	}
+	for _, call := range calls {
+		err := call()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readPoints gunzip the file, the members appended being read as a single stream
+func readPoints(t *testing.T, path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestLineProtocol(t *testing.T) {
+	root, err := ioutil.TempDir("", "safran-lp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	conf := config.InfluxConfig{Database: "db", Precision: "ms"}
+	path := filepath.Join(root, testExperiment.ID, "points.lp.gz")
+
+	o := NewLineProtocolOutput(root, conf)
+	saveLineProtocol(t, o, o.SaveExperiment, 1011.078125)
+	if files := o.Files(); len(files) != 1 || files[0] != "points.lp.gz" {
+		t.Errorf("files %v, expected points.lp.gz", files)
+	}
+
+	measureID := measureID(testExperiment.ID, &entity.Measure{Name: "pressure"})
+	header := []string{"# DML", "# CONTEXT-DATABASE: db"}
+	points := func(value string) []string {
+		return []string{
+			"experiments,id=" + testExperiment.ID + " bench=\"b\",campaign=\"c\",endDate=1548083100000i,name=\"test\",reference=\"t\",startDate=1548081060000i 1548081060000",
+			"measures,experimentID=" + testExperiment.ID + ",id=" + measureID + " name=\"pressure\",type=\"D32\",unit=\"mBar\" 1548081060000",
+			"samples,experimentID=" + testExperiment.ID + ",measureID=" + measureID + " value=" + value + " 1548081117700",
+			"alarms,experimentID=" + testExperiment.ID + " level=1i,message=\"Start black box recording\" 1548081117700",
+		}
+	}
+	checkLines := func(expected []string) {
+		lines := readPoints(t, path)
+		if len(lines) != len(expected) {
+			t.Fatalf("lines %q, expected %d", lines, len(expected))
+		}
+		for i, line := range lines {
+			if line != expected[i] {
+				t.Errorf("line %d %q, expected %q", i+1, line, expected[i])
+			}
+		}
+	}
+	first := append(header, points("1011.078125")...)
+	checkLines(first)
+
+	// the append is a second gzip member, read after the first one without a new header
+	o = NewLineProtocolOutput(root, conf)
+	saveLineProtocol(t, o, o.Append, 1012)
+	checkLines(append(first, points("1012")...))
+}
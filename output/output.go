@@ -1,6 +1,10 @@
 package output
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+
 	"github.com/leaklessgfy/safran-server/entity"
 )
 
@@ -12,3 +16,78 @@ type Output interface {
 	Cancel() error
 	End() error
 }
+
+// ContextOutput is an output giving up its pending calls once the context of the import is done
+type ContextOutput interface {
+	SetContext(context.Context)
+}
+
+// FileOutput is an output writing its results as files on the server disk,
+// Files return their paths relative to the experiment directory, a directory standing for all its files
+type FileOutput interface {
+	Files() []string
+}
+
+// AppendOutput is an output able to add data to an experiment already saved, called instead of SaveExperiment,
+// its Cancel only rolls back what the import appended
+type AppendOutput interface {
+	Append(*entity.Experiment) error
+}
+
+// RemoveOutput is an output able to delete the data of an experiment saved by a previous import
+type RemoveOutput interface {
+	Remove(experimentID string) error
+}
+
+// fileRoot is the directory of a file output, holding a directory per experiment
+type fileRoot struct {
+	root string
+}
+
+// experimentDir return the directory of the experiment files
+func (r fileRoot) experimentDir(experimentID string) string {
+	return filepath.Join(r.root, experimentID)
+}
+
+// Remove delete the files of a previous import of the experiment
+func (r fileRoot) Remove(experimentID string) error {
+	return os.RemoveAll(r.experimentDir(experimentID))
+}
+
+// fileSizes is the size of files before an import appends to them, -1 for the files missing
+type fileSizes map[string]int64
+
+func statSizes(paths ...string) (fileSizes, error) {
+	sizes := make(fileSizes)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			sizes[path] = -1
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sizes[path] = info.Size()
+	}
+	return sizes, nil
+}
+
+// restore cut the files back to their size, removing the ones created by the import
+func (s fileSizes) restore() error {
+	for path, size := range s {
+		var err error
+		if size < 0 {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.Truncate(path, size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
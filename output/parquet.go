@@ -0,0 +1,199 @@
+package output
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// parquetRowGroup is the row group size above which the writer flushes by itself,
+// the row groups being otherwise the batches given to SaveSamples
+const parquetRowGroup = 128 * 1024 * 1024
+
+// parquetSample is a row of samples.parquet, the value being in the column of its type
+type parquetSample struct {
+	Time        int64    `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Measure     string   `parquet:"name=measure, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Type        string   `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Unit        string   `parquet:"name=unit, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Value       *float64 `parquet:"name=value, type=DOUBLE, repetitiontype=OPTIONAL"`
+	ValueInt    *int64   `parquet:"name=value_int, type=INT64, repetitiontype=OPTIONAL"`
+	ValueBool   *bool    `parquet:"name=value_bool, type=BOOLEAN, repetitiontype=OPTIONAL"`
+	ValueString *string  `parquet:"name=value_string, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+// parquetAlarm is a row of alarms.parquet
+type parquetAlarm struct {
+	Time    int64  `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	Level   int32  `parquet:"name=level, type=INT32"`
+	Message string `parquet:"name=message, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+// ParquetOutput write the samples in root/{experimentID}/samples.parquet, one row per sample with snappy compressed columns,
+// and the alarms in the sibling alarms.parquet
+type ParquetOutput struct {
+	fileRoot
+	dir      string
+	file     source.ParquetFile
+	writer   *writer.ParquetWriter
+	alarms   source.ParquetFile
+	alarmsW  *writer.ParquetWriter
+	measures []*entity.Measure
+}
+
+// NewParquetOutput create a parquet output writing in root/{experimentID}/samples.parquet
+func NewParquetOutput(root string) *ParquetOutput {
+	return &ParquetOutput{fileRoot: fileRoot{root}}
+}
+
+func (o *ParquetOutput) SaveExperiment(experiment *entity.Experiment) error {
+	o.dir = o.experimentDir(experiment.ID)
+	err := os.MkdirAll(o.dir, 0777)
+	if err != nil {
+		return err
+	}
+	o.file, o.writer, err = createParquet(filepath.Join(o.dir, "samples.parquet"), new(parquetSample))
+	return err
+}
+
+func (o *ParquetOutput) SaveMeasures(measures []*entity.Measure) error {
+	o.measures = make([]*entity.Measure, 0, len(measures))
+	for _, measure := range measures {
+		o.measures = append(o.measures, &entity.Measure{
+			Name:  parquetString(measure.Name),
+			Typex: parquetString(measure.Typex),
+			Unitx: parquetString(measure.Unitx),
+			Type:  measure.Type,
+			Inc:   measure.Inc,
+		})
+	}
+	return nil
+}
+
+// SaveSamples write the samples as a row group
+func (o *ParquetOutput) SaveSamples(samples []*entity.Sample) error {
+	for _, sample := range samples {
+		if sample.Inc >= len(o.measures) {
+			return errors.New("sample index > measures length, index=" + strconv.Itoa(sample.Inc) + ", length=" + strconv.Itoa(len(o.measures)))
+		}
+		measure := o.measures[sample.Inc]
+		row := parquetSample{
+			Time:    sample.Time.UnixNano() / 1000,
+			Measure: measure.Name,
+			Type:    measure.Typex,
+			Unit:    measure.Unitx,
+		}
+		switch v := sample.Value.(type) {
+		case float64:
+			row.Value = &v
+		case int64:
+			row.ValueInt = &v
+		case bool:
+			row.ValueBool = &v
+		case string:
+			s := parquetString(v)
+			row.ValueString = &s
+		}
+		err := o.writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	return o.writer.Flush(true)
+}
+
+// SaveAlarms write the alarms to the sibling alarms.parquet
+func (o *ParquetOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	var err error
+	if o.alarmsW == nil {
+		o.alarms, o.alarmsW, err = createParquet(filepath.Join(o.dir, "alarms.parquet"), new(parquetAlarm))
+		if err != nil {
+			return err
+		}
+	}
+	for _, alarm := range alarms {
+		err = o.alarmsW.Write(parquetAlarm{
+			Time:    alarm.Time.UnixNano() / 1000,
+			Level:   int32(alarm.Level),
+			Message: parquetString(alarm.Message),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return o.alarmsW.Flush(true)
+}
+
+func (o ParquetOutput) Cancel() error {
+	if o.file == nil {
+		return nil
+	}
+	o.file.Close()
+	if o.alarms != nil {
+		o.alarms.Close()
+	}
+	return os.RemoveAll(o.dir)
+}
+
+// End write the footers holding the schema and the row groups index
+func (o ParquetOutput) End() error {
+	if o.alarmsW != nil {
+		err := closeParquet(o.alarms, o.alarmsW)
+		if err != nil {
+			return err
+		}
+	}
+	return closeParquet(o.file, o.writer)
+}
+
+func (o ParquetOutput) Files() []string {
+	files := []string{"samples.parquet"}
+	if o.alarms != nil {
+		files = append(files, "alarms.parquet")
+	}
+	return files
+}
+
+func createParquet(path string, schema interface{}) (source.ParquetFile, *writer.ParquetWriter, error) {
+	file, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := writer.NewParquetWriter(file, schema, 1)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	w.RowGroupSize = parquetRowGroup
+	w.CompressionType = parquet.CompressionCodec_SNAPPY
+	return file, w, nil
+}
+
+func closeParquet(file source.ParquetFile, w *writer.ParquetWriter) error {
+	err := w.WriteStop()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// parquetString return a valid UTF8 string, the bench files being latin1 when they aren't UTF8
+func parquetString(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	runes := make([]rune, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		runes = append(runes, rune(s[i]))
+	}
+	return string(runes)
+}
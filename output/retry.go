@@ -0,0 +1,92 @@
+package output
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/config"
+)
+
+// RetryOutput is an output retrying its failed calls, each retry being reported to the callback
+type RetryOutput interface {
+	OnRetry(func(attempt int, err error))
+}
+
+// transientErrors are the influx messages of the 5xx errors, the v1 client dropping the status code of the writes
+var transientErrors = []string{
+	"timeout",
+	"engine: cache maximum memory size exceeded",
+	"hinted handoff queue not empty",
+	"service unavailable",
+	"bad gateway",
+	"gateway timeout",
+}
+
+// statusError match the status codes the client keeps in the errors of the queries and the proxies
+var statusError = regexp.MustCompile(`status(?: code)?:? 5\d\d`)
+
+// retrier call a function until it succeeds, the delay between the attempts doubling up to a max
+type retrier struct {
+	attempts int
+	delay    time.Duration
+	maxDelay time.Duration
+	onRetry  func(attempt int, err error)
+}
+
+func newRetrier(conf config.RetryConfig) *retrier {
+	return &retrier{attempts: conf.Attempts, delay: conf.Delay.Duration, maxDelay: conf.MaxDelay.Duration}
+}
+
+// do call the function until it succeeds, it gives up once the context is done
+func (r *retrier) do(ctx context.Context, call func() error) error {
+	delay := r.delay
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || attempt >= r.attempts || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if r.onRetry != nil {
+			r.onRetry(attempt, err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		delay *= 2
+		if r.maxDelay > 0 && delay > r.maxDelay {
+			delay = r.maxDelay
+		}
+	}
+}
+
+// retryable tell if an error is transient: network failures, timeouts and 5xx,
+// the 4xx like schema conflicts or parse errors would fail again
+func retryable(err error) bool {
+	switch e := err.(type) {
+	case *url.Error:
+		if _, ok := e.Err.(*net.OpError); ok {
+			return true
+		}
+		return e.Timeout() || e.Err == io.EOF || e.Err == io.ErrUnexpectedEOF
+	case net.Error:
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	if statusError.MatchString(msg) {
+		return true
+	}
+	for _, transient := range transientErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,374 @@
+package output
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlBatch is the maximum rows of a multi-row INSERT, sqlite limiting the variables of a statement
+const sqlBatch = 500
+
+var (
+	databases     = make(map[string]*sql.DB)
+	databasesLock sync.Mutex
+)
+
+// SQLOutput save the experiments in the experiments, measures, samples and alarms tables of a sqlite or postgres database,
+// the whole import being a transaction committed by End and rolled back by Cancel,
+// begun by the first save so the connection is only held while the import runs
+type SQLOutput struct {
+	driver     string
+	db         *sql.DB
+	ctx        context.Context
+	conn       *sql.Conn
+	tx         *sql.Tx
+	lock       sync.Mutex
+	experiment *entity.Experiment
+	removed    string
+	measuresID []string
+}
+
+// NewSQLOutput create a sql output, the database being opened and migrated at its first use
+func NewSQLOutput(conf config.SQLConfig) (*SQLOutput, error) {
+	db, err := openDatabase(conf.Driver, conf.DSN)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLOutput{driver: conf.Driver, db: db, ctx: context.Background()}, nil
+}
+
+// SetContext stop waiting for a connection once ctx is done, sqlite having a single one
+func (o *SQLOutput) SetContext(ctx context.Context) {
+	o.ctx = ctx
+}
+
+// openDatabase return the connections pool of the database, shared by the imports
+func openDatabase(driver, dsn string) (*sql.DB, error) {
+	databasesLock.Lock()
+	defer databasesLock.Unlock()
+
+	key := driver + ":" + dsn
+	if db, ok := databases[key]; ok {
+		return db, nil
+	}
+	if driver != "sqlite3" && driver != "postgres" {
+		return nil, errors.New("unsupported sql driver " + driver + ", expected sqlite3 or postgres")
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite3" {
+		// sqlite has a single writer, the imports wait for each other instead of failing on a locked database
+		db.SetMaxOpenConns(1)
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	databases[key] = db
+	return db, nil
+}
+
+// SaveExperiment keep the experiment, inserted with the first saved rows
+func (o *SQLOutput) SaveExperiment(experiment *entity.Experiment) error {
+	o.experiment = experiment
+	return nil
+}
+
+// Remove delete the rows of a previous import of the experiment, in the transaction of the import
+// so they are only gone once the import is committed
+func (o *SQLOutput) Remove(experimentID string) error {
+	o.removed = experimentID
+	return nil
+}
+
+// begin take a connection and start the transaction of the import, deleting the removed experiment
+// and inserting the experiment, the transaction itself is not bound to ctx so End can still commit it
+func (o *SQLOutput) begin(ctx context.Context) error {
+	if o.tx != nil {
+		return nil
+	}
+	conn, err := o.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	o.conn, o.tx = conn, tx
+
+	if o.removed != "" {
+		for _, table := range []string{"alarms", "samples", "measures"} {
+			_, err = o.tx.Exec(o.query(`DELETE FROM `+table+` WHERE experiment_id = ?`), o.removed)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = o.tx.Exec(o.query(`DELETE FROM experiments WHERE id = ?`), o.removed)
+		if err != nil {
+			return err
+		}
+	}
+	experiment := o.experiment
+	_, err = o.tx.Exec(o.query(`INSERT INTO experiments (id, reference, name, bench, campaign, start_date, end_date) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+		experiment.ID, experiment.Reference, experiment.Name, experiment.Bench, experiment.Campaign, experiment.StartDate, experiment.EndDate)
+	return err
+}
+
+func (o *SQLOutput) SaveMeasures(measures []*entity.Measure) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	err := o.begin(o.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]interface{}, 0, len(measures))
+	o.measuresID = nil
+	for _, measure := range measures {
+		id := measureID(o.experiment.ID, measure)
+		rows = append(rows, []interface{}{id, o.experiment.ID, measure.Inc, measure.Name, measure.Typex, measure.Unitx})
+		o.measuresID = append(o.measuresID, id)
+	}
+	return o.insert("measures", []string{"id", "experiment_id", "inc", "name", "type", "unit"}, rows)
+}
+
+func (o *SQLOutput) SaveSamples(samples []*entity.Sample) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	err := o.begin(o.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]interface{}, 0, len(samples))
+	for _, sample := range samples {
+		if sample.Inc >= len(o.measuresID) {
+			return errors.New("sample index > measures length, index=" + strconv.Itoa(sample.Inc) + ", length=" + strconv.Itoa(len(o.measuresID)))
+		}
+		value, text := sqlValue(sample.Value)
+		rows = append(rows, []interface{}{o.experiment.ID, o.measuresID[sample.Inc], sample.Time, value, text})
+	}
+	return o.insert("samples", []string{"experiment_id", "measure_id", "time", "value", "value_text"}, rows)
+}
+
+func (o *SQLOutput) SaveAlarms(alarms []*entity.Alarm) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	err := o.begin(o.ctx)
+	if err != nil {
+		return err
+	}
+	rows := make([][]interface{}, 0, len(alarms))
+	for _, alarm := range alarms {
+		rows = append(rows, []interface{}{o.experiment.ID, alarm.Time, alarm.Level, alarm.Message})
+	}
+	return o.insert("alarms", []string{"experiment_id", "time", "level", "message"}, rows)
+}
+
+// Cancel roll back the import, nothing of the experiment is left in the database
+func (o *SQLOutput) Cancel() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.tx == nil {
+		return nil
+	}
+	err := o.tx.Rollback()
+	o.conn.Close()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+// End commit the import, the import being stopped the connection is taken whatever the context
+func (o *SQLOutput) End() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	err := o.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	err = o.tx.Commit()
+	o.conn.Close()
+	return err
+}
+
+// insert add the rows to the table, through COPY on postgres and multi-row INSERT on sqlite
+func (o *SQLOutput) insert(table string, columns []string, rows [][]interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if o.driver == "postgres" {
+		return o.copy(table, columns, rows)
+	}
+
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	for start := 0; start < len(rows); start += sqlBatch {
+		end := start + sqlBatch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		values := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, r := range rows[start:end] {
+			values = append(values, row)
+			args = append(args, r...)
+		}
+		statement := `INSERT INTO ` + table + ` (` + strings.Join(columns, ", ") + `) VALUES ` + strings.Join(values, ", ")
+		_, err := o.tx.Exec(statement, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *SQLOutput) copy(table string, columns []string, rows [][]interface{}) error {
+	statement, err := o.tx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		_, err = statement.Exec(row...)
+		if err != nil {
+			statement.Close()
+			return err
+		}
+	}
+	_, err = statement.Exec()
+	if err != nil {
+		statement.Close()
+		return err
+	}
+	return statement.Close()
+}
+
+// query replace the ? placeholders by the $n of postgres
+func (o *SQLOutput) query(query string) string {
+	if o.driver != "postgres" {
+		return query
+	}
+	var builder strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(c)
+	}
+	return builder.String()
+}
+
+// sqlValue return the numeric and text columns of a sample value, the booleans being stored as 0 and 1
+func sqlValue(value interface{}) (interface{}, interface{}) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	case string:
+		return nil, v
+	}
+	return nil, nil
+}
+
+// migrations are the schema versions, a migration is never changed once released, a new one is added instead
+var migrations = []string{
+	`CREATE TABLE experiments (
+		id VARCHAR(36) PRIMARY KEY,
+		reference TEXT NOT NULL,
+		name TEXT NOT NULL,
+		bench TEXT NOT NULL,
+		campaign TEXT NOT NULL,
+		start_date TIMESTAMP NOT NULL,
+		end_date TIMESTAMP NOT NULL
+	);
+	CREATE TABLE measures (
+		id VARCHAR(36) PRIMARY KEY,
+		experiment_id VARCHAR(36) NOT NULL,
+		inc INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		type TEXT NOT NULL,
+		unit TEXT NOT NULL
+	);
+	CREATE INDEX measures_experiment ON measures (experiment_id);
+	CREATE TABLE samples (
+		experiment_id VARCHAR(36) NOT NULL,
+		measure_id VARCHAR(36) NOT NULL,
+		time TIMESTAMP NOT NULL,
+		value DOUBLE PRECISION,
+		value_text TEXT
+	);
+	CREATE INDEX samples_experiment_measure_time ON samples (experiment_id, measure_id, time);
+	CREATE TABLE alarms (
+		experiment_id VARCHAR(36) NOT NULL,
+		time TIMESTAMP NOT NULL,
+		level INTEGER NOT NULL,
+		message TEXT NOT NULL
+	);
+	CREATE INDEX alarms_experiment_time ON alarms (experiment_id, time);`,
+}
+
+// migrate apply the migrations the database is missing, recording the version in schema_migrations
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+	var version int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, statement := range strings.Split(migrations[i], ";") {
+			if strings.TrimSpace(statement) == "" {
+				continue
+			}
+			_, err = tx.Exec(statement)
+			if err != nil {
+				tx.Rollback()
+				return errors.New("migration " + strconv.Itoa(i+1) + " failed: " + err.Error())
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version) VALUES (` + strconv.Itoa(i+1) + `)`)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
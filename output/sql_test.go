@@ -0,0 +1,186 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/config"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// sqliteDSN create a fresh sqlite database file, removed with its pool by the returned func
+func sqliteDSN(t *testing.T) (config.SQLConfig, func()) {
+	dir, err := ioutil.TempDir("", "safran-sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := config.SQLConfig{Driver: "sqlite3", DSN: filepath.Join(dir, "safran.db")}
+	return conf, func() {
+		databasesLock.Lock()
+		key := conf.Driver + ":" + conf.DSN
+		if db, ok := databases[key]; ok {
+			db.Close()
+			delete(databases, key)
+		}
+		databasesLock.Unlock()
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestSQLOutput(t *testing.T, conf config.SQLConfig) *SQLOutput {
+	o, err := NewSQLOutput(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// saveTestImport save testExperiment with a measure, the samples of values and an alarm
+func saveTestImport(t *testing.T, o *SQLOutput, values ...float64) {
+	sampleTime := time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC)
+	samples := make([]*entity.Sample, 0, len(values))
+	for i, value := range values {
+		samples = append(samples, &entity.Sample{Time: sampleTime.Add(time.Duration(i) * time.Second), Value: value})
+	}
+	calls := []func() error{
+		func() error { return o.SaveExperiment(testExperiment) },
+		func() error {
+			return o.SaveMeasures([]*entity.Measure{{Name: "pressure", Typex: "D32", Unitx: "mBar", Type: entity.ValueFloat}})
+		},
+		func() error { return o.SaveSamples(samples) },
+		func() error {
+			return o.SaveAlarms([]*entity.Alarm{{Time: sampleTime, Level: 1, Message: "Start black box recording"}})
+		},
+	}
+	for _, call := range calls {
+		err := call()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countRows return the rows of testExperiment in each table
+func countRows(t *testing.T, o *SQLOutput) map[string]int {
+	counts := make(map[string]int)
+	queries := map[string]string{
+		"experiments": `SELECT COUNT(*) FROM experiments WHERE id = ?`,
+		"measures":    `SELECT COUNT(*) FROM measures WHERE experiment_id = ?`,
+		"samples":     `SELECT COUNT(*) FROM samples WHERE experiment_id = ?`,
+		"alarms":      `SELECT COUNT(*) FROM alarms WHERE experiment_id = ?`,
+	}
+	for table, query := range queries {
+		var count int
+		err := o.db.QueryRow(query, testExperiment.ID).Scan(&count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[table] = count
+	}
+	return counts
+}
+
+func expectRows(t *testing.T, o *SQLOutput, experiments, samples int) {
+	counts := countRows(t, o)
+	expected := map[string]int{"experiments": experiments, "measures": experiments, "samples": samples, "alarms": experiments}
+	for table, count := range expected {
+		if counts[table] != count {
+			t.Errorf("%d rows in %s, expected %d", counts[table], table, count)
+		}
+	}
+}
+
+func TestSQLMigrate(t *testing.T) {
+	conf, cleanup := sqliteDSN(t)
+	defer cleanup()
+	o := newTestSQLOutput(t, conf)
+
+	var version int
+	err := o.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("schema version %d, expected %d", version, len(migrations))
+	}
+	// a database up to date is left as is
+	err = migrate(o.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, o, 0, 0)
+}
+
+func TestSQLEnd(t *testing.T) {
+	conf, cleanup := sqliteDSN(t)
+	defer cleanup()
+	o := newTestSQLOutput(t, conf)
+
+	saveTestImport(t, o, 1011.078125, 1011.5)
+	err := o.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, o, 1, 2)
+
+	var value float64
+	err = o.db.QueryRow(`SELECT value FROM samples WHERE experiment_id = ? ORDER BY time LIMIT 1`, testExperiment.ID).Scan(&value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != 1011.078125 {
+		t.Errorf("first sample %v, expected 1011.078125", value)
+	}
+}
+
+func TestSQLCancel(t *testing.T) {
+	conf, cleanup := sqliteDSN(t)
+	defer cleanup()
+	o := newTestSQLOutput(t, conf)
+
+	saveTestImport(t, o, 1011.078125, 1011.5)
+	err := o.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, o, 0, 0)
+}
+
+func TestSQLReimport(t *testing.T) {
+	conf, cleanup := sqliteDSN(t)
+	defer cleanup()
+	first := newTestSQLOutput(t, conf)
+	saveTestImport(t, first, 1, 2)
+	err := first.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cancelled import keeps the rows of the previous one, the delete being in its transaction
+	cancelled := newTestSQLOutput(t, conf)
+	err = cancelled.Remove(testExperiment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveTestImport(t, cancelled, 3, 4, 5)
+	err = cancelled.Cancel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, cancelled, 1, 2)
+
+	replaced := newTestSQLOutput(t, conf)
+	err = replaced.Remove(testExperiment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveTestImport(t, replaced, 3, 4, 5)
+	err = replaced.End()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectRows(t, replaced, 1, 3)
+}
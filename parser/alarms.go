@@ -1,47 +1,68 @@
 package parser
 
 import (
-	"bufio"
-	"errors"
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/leaklessgfy/safran-server/entity"
 )
 
 type AlarmsParser struct {
-	scanner *bufio.Scanner
+	rejecter
+	reader *lineReader
+	record record
 }
 
-// NewAlarmsParser create a Sample Parser with the scanner
+// NewAlarmsParser create an Alarms Parser with the reader
 func NewAlarmsParser(reader io.Reader) *AlarmsParser {
-	return &AlarmsParser{bufio.NewScanner(reader)}
+	return &AlarmsParser{reader: newLineReader(reader, entity.FileAlarms)}
+}
+
+// SetRecord set the record range used to resolve the alarms time
+func (p *AlarmsParser) SetRecord(start, end time.Time) {
+	p.record = record{start: start, end: end}
 }
 
 // ParseAlarms parse alarms in the file
-func (p AlarmsParser) ParseAlarms() ([]*entity.Alarm, int, error) {
+func (p *AlarmsParser) ParseAlarms() ([]*entity.Alarm, int, error) {
 	var alarms []*entity.Alarm
 	fullSize := 0
-	for p.scanner.Scan() {
-		line := p.scanner.Text()
+	for p.reader.Scan() {
+		line := p.reader.Text()
 		fullSize += len([]byte(line))
 		if len(line) < 1 {
 			return alarms, fullSize, nil
 		}
-		arr := strings.Split(line, separator)
-		if len(arr) < 3 {
-			return alarms, fullSize, errors.New("Badly formatted alarm line")
-		}
-		time := strings.Split(arr[0], " ")
-		if len(time) < 2 {
-			return alarms, fullSize, errors.New("Badly formatted alarm time")
-		}
-		level, err := strconv.Atoi(arr[1])
+		alarm, err := p.parseAlarm(line)
 		if err != nil {
-			return alarms, fullSize, err
+			if !p.reject(line, err) {
+				return alarms, fullSize, err
+			}
+			continue
 		}
-		alarms = append(alarms, &entity.Alarm{Time: time[1], Level: level, Message: arr[2]})
+		alarms = append(alarms, alarm)
+	}
+	return alarms, fullSize, p.reader.Err()
+}
+
+func (p *AlarmsParser) parseAlarm(line string) (*entity.Alarm, *entity.ParseError) {
+	arr := strings.Split(line, separator)
+	if len(arr) < 3 {
+		return nil, p.reader.Error(0, line, "Badly formatted alarm line")
+	}
+	date := strings.Split(arr[0], " ")
+	if len(date) < 2 {
+		return nil, p.reader.Error(1, arr[0], "Badly formatted alarm time")
+	}
+	level, err := strconv.Atoi(arr[1])
+	if err != nil {
+		return nil, p.reader.Error(2, arr[1], "invalid level "+strconv.Quote(arr[1]))
+	}
+	t, err := p.record.resolve(date[0], date[1])
+	if err != nil {
+		return nil, p.reader.Error(1, arr[0], err.Error())
 	}
-	return alarms, fullSize, nil
+	return &entity.Alarm{Time: t, Level: level, Message: arr[2]}, nil
 }
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// Batch is a block of sample lines, read in the file order, converted in any order then resolved in the file order
+type Batch struct {
+	first int
+	size  int
+	rows  []row
+}
+
+type row struct {
+	raw      string
+	blank    bool
+	day      string
+	time     string
+	samples  []*entity.Sample
+	err      *entity.ParseError
+	valueErr *entity.ParseError
+}
+
+// Size return the bytes read for the batch
+func (b *Batch) Size() int {
+	if b == nil {
+		return 0
+	}
+	return b.size
+}
+
+// ReadBatch read up to limit sample lines, without parsing them
+func (p *SamplesParser) ReadBatch(limit int) (*Batch, bool, error) {
+	batch := &Batch{first: p.reader.Line() + 1}
+	for n := 0; n < limit; n++ {
+		if !p.reader.Scan() {
+			return batch, true, p.reader.Err()
+		}
+		line := p.reader.Text()
+		batch.size += len([]byte(line))
+		batch.rows = append(batch.rows, row{raw: line})
+	}
+	return batch, false, nil
+}
+
+// Convert split the lines of the batch and convert their values,
+// it only reads the measures so batches can be converted concurrently
+func (p *SamplesParser) Convert(batch *Batch) {
+	sep := p.format.Separator()
+	columns := len(p.measures) + offset
+
+	for n := range batch.rows {
+		r := &batch.rows[n]
+		line := batch.first + n
+
+		// the blank lines, as the trailing one of most files, hold no sample
+		if strings.TrimSpace(r.raw) == "" {
+			r.blank = true
+			continue
+		}
+		arr := strings.Split(r.raw, sep)
+		if len(arr) > columns {
+			msg := fmt.Sprintf("%d columns for %d measures", len(arr), columns)
+			r.err = parseError(entity.FileSamples, line, columns+1, strings.Join(arr[columns:], sep), msg)
+			continue
+		}
+		if len(arr) < offset {
+			r.err = parseError(entity.FileSamples, line, 0, r.raw, "Missing day and time columns")
+			continue
+		}
+		r.day, r.time = arr[0], arr[1]
+
+		for i := 2; i < len(arr); i++ {
+			if len(arr[i]) > 0 && arr[i] != nan {
+				measure := p.measures[i-offset]
+				value, err := entity.ParseValue(measure.Type, arr[i])
+				if err != nil {
+					r.valueErr = parseError(entity.FileSamples, line, i+1, arr[i], err.Error())
+					r.valueErr.Measure = measure.Name
+					r.samples = nil
+					break
+				}
+				r.samples = append(r.samples, &entity.Sample{Value: value, Inc: i - offset})
+			}
+		}
+	}
+}
+
+// Resolve compute the time of the converted rows, in the file order, and return their samples,
+// the malformed rows are rejected according to the policy
+func (p *SamplesParser) Resolve(batch *Batch) ([]*entity.Sample, error) {
+	var samples []*entity.Sample
+	sep := p.format.Separator()
+
+	for n, r := range batch.rows {
+		if r.blank {
+			continue
+		}
+		err := r.err
+		if err == nil {
+			t, errTime := p.record.resolve(r.day, r.time)
+			if errTime != nil {
+				err = parseError(entity.FileSamples, batch.first+n, 1, r.day+sep+r.time, errTime.Error())
+			} else {
+				err = r.valueErr
+				for _, sample := range r.samples {
+					sample.Time = t
+				}
+			}
+		}
+		if err != nil {
+			if !p.reject(r.raw, err) {
+				return samples, err
+			}
+			continue
+		}
+		samples = append(samples, r.samples...)
+	}
+	return samples, nil
+}
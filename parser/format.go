@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Line is a kind of header line in a samples file
+type Line int
+
+const (
+	LineStartDate Line = iota
+	LineEndDate
+	LineNames
+	LineBlank
+	LineTypes
+	LineUnits
+)
+
+// BenchHeader is the header order of the bench exports: two dates, the names, a blank line, the types and the units
+var BenchHeader = []Line{LineStartDate, LineEndDate, LineNames, LineBlank, LineTypes, LineUnits}
+
+// Format describe the layout of a samples file
+type Format interface {
+	// Name is the key used to pick the format on upload
+	Name() string
+	// Separator split the columns of a line
+	Separator() string
+	// Header is the order of the lines before the samples
+	Header() []Line
+	// Sniff tell if the first lines of a file match the format
+	Sniff(lines []string) bool
+}
+
+// DelimitedFormat is a format of separated columns, the two first columns of the samples being the day and the time
+type DelimitedFormat struct {
+	name      string
+	separator string
+	header    []Line
+}
+
+// NewDelimitedFormat create a format with the separator and the header order
+func NewDelimitedFormat(name, separator string, header ...Line) DelimitedFormat {
+	return DelimitedFormat{name: name, separator: separator, header: header}
+}
+
+func (f DelimitedFormat) Name() string {
+	return f.name
+}
+
+func (f DelimitedFormat) Separator() string {
+	return f.separator
+}
+
+func (f DelimitedFormat) Header() []Line {
+	return f.header
+}
+
+// Sniff check each header line has the expected shape and the names, types and units have the same columns
+func (f DelimitedFormat) Sniff(lines []string) bool {
+	if len(lines) < len(f.header) {
+		return false
+	}
+	columns := 0
+	for i, kind := range f.header {
+		arr := strings.Split(lines[i], f.separator)
+		switch kind {
+		case LineStartDate, LineEndDate:
+			if len(arr) < 2 || arr[0] == "" || arr[1] == "" {
+				return false
+			}
+		case LineBlank:
+			if strings.Trim(lines[i], f.separator) != "" {
+				return false
+			}
+		case LineNames, LineTypes, LineUnits:
+			if len(arr) <= offset || (columns > 0 && len(arr) != columns) {
+				return false
+			}
+			columns = len(arr)
+		}
+	}
+	return true
+}
+
+// DefaultFormat is the semicolon layout of the bench exports, used when no format is detected
+var DefaultFormat Format = NewDelimitedFormat("bench", separator, BenchHeader...)
+
+var (
+	formatsLock sync.RWMutex
+	formats     = []Format{
+		DefaultFormat,
+		NewDelimitedFormat("csv", ",", BenchHeader...),
+		NewDelimitedFormat("tsv", "\t", BenchHeader...),
+	}
+)
+
+// RegisterFormat add a format to the registry, replacing the one with the same name
+func RegisterFormat(format Format) {
+	formatsLock.Lock()
+	defer formatsLock.Unlock()
+
+	for i, f := range formats {
+		if f.Name() == format.Name() {
+			formats[i] = format
+			return
+		}
+	}
+	formats = append(formats, format)
+}
+
+// Formats return the registered formats, in detection order
+func Formats() []Format {
+	formatsLock.RLock()
+	defer formatsLock.RUnlock()
+
+	return append([]Format{}, formats...)
+}
+
+// GetFormat return the registered format with the name
+func GetFormat(name string) (Format, error) {
+	var names []string
+	for _, format := range Formats() {
+		if format.Name() == name {
+			return format, nil
+		}
+		names = append(names, format.Name())
+	}
+	return nil, errors.New("Unknown format " + name + ", expected one of " + strings.Join(names, ", "))
+}
+
+// DetectFormat sniff the header lines of the reader to find its format, falling back on the default one,
+// the lines are read whatever their length, the returned reader must be read in place of the given one
+func DetectFormat(reader io.Reader) (Format, io.Reader, error) {
+	formats := Formats()
+	count := 0
+	for _, format := range formats {
+		if len(format.Header()) > count {
+			count = len(format.Header())
+		}
+	}
+
+	buffered := bufio.NewReader(reader)
+	var consumed bytes.Buffer
+	var lines []string
+	for len(lines) < count {
+		line, err := buffered.ReadString('\n')
+		consumed.WriteString(line)
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if len(line) > 0 {
+			lines = append(lines, strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"))
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	rest := io.MultiReader(&consumed, buffered)
+	for _, format := range formats {
+		if format.Sniff(lines) {
+			return format, rest, nil
+		}
+	}
+	return DefaultFormat, rest, nil
+}
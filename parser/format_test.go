@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// benchFile build a samples file of the bench header, with columns measures and the separator
+func benchFile(sep string, columns int, rows ...string) string {
+	names := []string{"Day in year", "Time"}
+	types := []string{"", ""}
+	units := []string{"", ""}
+	for i := 0; i < columns; i++ {
+		names = append(names, "measure_"+strings.Repeat("x", 10)+string(rune('a'+i%26)))
+		types = append(types, "D32")
+		units = append(units, "mBar")
+	}
+	lines := []string{
+		"RecordStartTime" + sep + "2019-01-21T14:31:00.000",
+		"RecordEndTime" + sep + "2019-01-21T15:05:00.000",
+		strings.Join(names, sep),
+		strings.Repeat(sep, columns+1),
+		strings.Join(types, sep),
+		strings.Join(units, sep),
+	}
+	return strings.Join(append(lines, rows...), "\n") + "\n"
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		format string
+	}{
+		{"bench", benchFile(";", 3, "21;31:57,7;1;2;3"), "bench"},
+		{"csv", benchFile(",", 3, "21,31:57.7,1,2,3"), "csv"},
+		{"tsv", benchFile("\t", 3, "21\t31:57.7\t1\t2\t3"), "tsv"},
+		{"csv header wider than 64 KB", benchFile(",", 10000, "21,31:57.7"+strings.Repeat(",1", 10000)), "csv"},
+		{"unknown falls back on bench", "a|b\nc|d\n", "bench"},
+		{"header cut short", "RecordStartTime,2019-01-21T14:31:00.000\n", "bench"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, reader, err := DetectFormat(strings.NewReader(test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format.Name() != test.format {
+				t.Errorf("detected %s, expected %s", format.Name(), test.format)
+			}
+			b, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != test.file {
+				t.Errorf("the returned reader lost bytes, %d read of %d", len(b), len(test.file))
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"errors"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+// Policy tell how the parsers handle a malformed row
+type Policy string
+
+const (
+	// PolicyStrict fail the import on the first malformed row
+	PolicyStrict Policy = "strict"
+	// PolicySkip drop the malformed rows
+	PolicySkip Policy = "skip"
+	// PolicyQuarantine drop the malformed rows, keeping them for review
+	PolicyQuarantine Policy = "quarantine"
+)
+
+// ParsePolicy return the policy with the name
+func ParsePolicy(name string) (Policy, error) {
+	switch Policy(name) {
+	case PolicyStrict, PolicySkip, PolicyQuarantine:
+		return Policy(name), nil
+	}
+	return "", errors.New("Unknown error policy " + name + ", expected one of strict, skip, quarantine")
+}
+
+// rejecter keep the rows dropped by a lenient policy
+type rejecter struct {
+	policy  Policy
+	rejects []entity.Reject
+}
+
+// SetPolicy set how the malformed rows are handled, strict by default
+func (r *rejecter) SetPolicy(policy Policy) {
+	r.policy = policy
+}
+
+// Rejects return the rows dropped since the last call
+func (r *rejecter) Rejects() []entity.Reject {
+	rejects := r.rejects
+	r.rejects = nil
+	return rejects
+}
+
+// reject drop the row unless the policy is strict
+func (r *rejecter) reject(raw string, err *entity.ParseError) bool {
+	if r.policy != PolicySkip && r.policy != PolicyQuarantine {
+		return false
+	}
+	r.rejects = append(r.rejects, entity.Reject{Raw: raw, Error: *err})
+	return true
+}
@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+const maxExcerpt = 80
+
+// lineReader read the lines of a file whatever their length, unlike bufio.Scanner limited to 64 KB
+type lineReader struct {
+	reader *bufio.Reader
+	file   string
+	text   string
+	line   int
+	err    error
+}
+
+func newLineReader(reader io.Reader, file string) *lineReader {
+	return &lineReader{reader: bufio.NewReader(reader), file: file}
+}
+
+// Scan read the next line, it returns false at the end of the file or on a read error
+func (l *lineReader) Scan() bool {
+	if l.err != nil {
+		return false
+	}
+	text, err := l.reader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		l.err = &entity.ParseError{File: l.file, Line: l.line + 1, Message: err.Error()}
+		return false
+	}
+	if err == io.EOF && len(text) == 0 {
+		return false
+	}
+	l.line++
+	l.text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+	return true
+}
+
+// Text return the last line read, without its line ending
+func (l *lineReader) Text() string {
+	return l.text
+}
+
+// Line return the number of the last line read
+func (l *lineReader) Line() int {
+	return l.line
+}
+
+// Err return the read error which stopped Scan, nil at the end of the file
+func (l *lineReader) Err() error {
+	return l.err
+}
+
+// Error create a parse error located on the last line read, the excerpt being cut when too long
+func (l *lineReader) Error(column int, excerpt string, msg string) *entity.ParseError {
+	return parseError(l.file, l.line, column, excerpt, msg)
+}
+
+func parseError(file string, line, column int, excerpt string, msg string) *entity.ParseError {
+	if len(excerpt) > maxExcerpt {
+		excerpt = excerpt[:maxExcerpt] + "..."
+	}
+	return &entity.ParseError{File: file, Line: line, Column: column, Excerpt: excerpt, Message: msg}
+}
@@ -1,16 +1,24 @@
 package parser
 
 import (
-	"bufio"
 	"errors"
 	"io"
-	"strings"
+	"time"
 
 	"github.com/leaklessgfy/safran-server/entity"
 )
 
 type SamplesParser struct {
-	scanner *bufio.Scanner
+	rejecter
+	reader   *lineReader
+	format   Format
+	next     int
+	header   Header
+	measures []*entity.Measure
+	types    []string
+	units    []string
+	lines    map[Line]int
+	record   record
 }
 
 type Header struct {
@@ -22,103 +30,115 @@ const offset = 2
 const separator = ";"
 const nan = "NaN"
 
-// NewSamplesParser create a Sample Parser with the scanner
-func NewSamplesParser(reader io.Reader) *SamplesParser {
-	return &SamplesParser{bufio.NewScanner(reader)}
+// NewSamplesParser create a Sample Parser with the reader, reading the layout of the format
+func NewSamplesParser(reader io.Reader, format Format) *SamplesParser {
+	return &SamplesParser{reader: newLineReader(reader, entity.FileSamples), format: format, lines: make(map[Line]int)}
 }
 
-// ParseHeader parse the start and end date of the file
-func (p SamplesParser) ParseHeader() (*Header, int, error) {
-	startDate, sizeStart, err := p.parseDate()
-	if err != nil {
-		return nil, 0, err
+// SetRecord set the record range used to resolve the samples time
+func (p *SamplesParser) SetRecord(start, end time.Time) {
+	p.record = record{start: start, end: end}
+}
+
+// ParseHeader parse the header lines up to the start and end date of the file
+func (p *SamplesParser) ParseHeader() (*Header, int, error) {
+	last := -1
+	for i, kind := range p.format.Header() {
+		if kind == LineStartDate || kind == LineEndDate {
+			last = i
+		}
 	}
-	endDate, sizeEnd, err := p.parseDate()
+	size, err := p.parseHeader(last + 1)
 	if err != nil {
 		return nil, 0, err
 	}
-	return &Header{startDate, endDate}, sizeStart + sizeEnd, nil
+	if p.header.StartDate == "" || p.header.EndDate == "" {
+		return nil, 0, errors.New("Missing dates in format " + p.format.Name())
+	}
+	header := p.header
+	return &header, size, nil
 }
 
-// ParseMeasures parse the measures of the file
-func (p SamplesParser) ParseMeasures() ([]*entity.Measure, int, error) {
-	measures, sizeM, err := p.parseMeasures()
+// ParseMeasures parse the remaining header lines, merging the names, types and units into the measures
+func (p *SamplesParser) ParseMeasures() ([]*entity.Measure, int, error) {
+	size, err := p.parseHeader(len(p.format.Header()))
 	if err != nil {
 		return nil, 0, err
 	}
-	types, sizeT, err := parseLine(p.scanner, 2, 0)
-	if err != nil {
-		return nil, 0, err
+	if p.measures == nil {
+		return nil, 0, errors.New("Missing names in format " + p.format.Name())
 	}
-	units, sizeU, err := parseLine(p.scanner, 2, 0)
+	err = p.mergeTypesUnits(p.measures, p.types, p.units)
 	if err != nil {
 		return nil, 0, err
 	}
-	err = p.mergeTypesUnits(measures, types, units)
-	if err != nil {
-		return nil, 0, err
-	}
-	return measures, sizeM + sizeT + sizeU, nil
+	return p.measures, size, nil
 }
 
-// ParseSamples parse the samples of the file
-func (p SamplesParser) ParseSamples(limit int) ([]*entity.Sample, int, bool) {
-	var samples []*entity.Sample
+// parseHeader read the header lines of the format until the index
+func (p *SamplesParser) parseHeader(until int) (int, error) {
 	var size int
-
-	for n := 0; n < limit; n++ {
-		if !p.scanner.Scan() {
-			return samples, size, true
+	header := p.format.Header()
+	sep := p.format.Separator()
+
+	for ; p.next < until; p.next++ {
+		var arr []string
+		var n int
+		var err error
+
+		switch header[p.next] {
+		case LineBlank:
+			if !p.reader.Scan() {
+				return 0, readError(p.reader)
+			}
+			n = len([]byte(p.reader.Text()))
+		case LineStartDate, LineEndDate:
+			arr, n, err = parseLine(p.reader, sep, 1, 1)
+		default:
+			arr, n, err = parseLine(p.reader, sep, offset, 0)
 		}
-
-		line := p.scanner.Text()
-		size += len([]byte(line))
-		arr := strings.Split(line, separator)
-
-		for i := 2; i < len(arr); i++ {
-			if len(arr[i]) > 0 && arr[i] != nan {
-				samples = append(samples, &entity.Sample{Value: arr[i], Time: arr[1], Inc: i - offset})
+		if err != nil {
+			return 0, err
+		}
+		size += n
+		p.lines[header[p.next]] = p.reader.Line()
+
+		switch header[p.next] {
+		case LineStartDate:
+			p.header.StartDate = arr[0]
+		case LineEndDate:
+			p.header.EndDate = arr[0]
+		case LineNames:
+			for i, m := range arr {
+				p.measures = append(p.measures, &entity.Measure{Name: m, Inc: i, Type: entity.ValueString})
 			}
+		case LineTypes:
+			p.types = arr
+		case LineUnits:
+			p.units = arr
 		}
 	}
-
-	return samples, size, false
-}
-
-func (p SamplesParser) parseDate() (string, int, error) {
-	arr, size, err := parseLine(p.scanner, 1, 1)
-	if err != nil {
-		return "", 0, err
-	}
-	return arr[0], size, nil
-}
-
-func (p SamplesParser) parseMeasures() ([]*entity.Measure, int, error) {
-	arr, size, err := parseLine(p.scanner, 2, 0)
-	if err != nil {
-		return nil, 0, err
-	}
-	var measures []*entity.Measure
-	for i, m := range arr {
-		measures = append(measures, &entity.Measure{Name: m, Inc: i})
-	}
-	p.scanner.Scan()
-	b := []byte(p.scanner.Text())
-	return measures, size + len(b), nil
+	return size, nil
 }
 
-func (p SamplesParser) mergeTypesUnits(measures []*entity.Measure, types, units []string) error {
-	if len(types) != len(measures) {
-		return errors.New("Types length != measures length")
+func (p *SamplesParser) mergeTypesUnits(measures []*entity.Measure, types, units []string) error {
+	if types != nil && len(types) != len(measures) {
+		return p.headerError(LineTypes, "Types length != measures length")
 	}
-	if len(units) != len(measures) {
-		return errors.New("Units length != measures length")
+	if units != nil && len(units) != len(measures) {
+		return p.headerError(LineUnits, "Units length != measures length")
 	}
 	for i, typex := range types {
 		measures[i].Typex = typex
+		measures[i].Type = entity.TypeOf(typex)
 	}
 	for i, unitx := range units {
 		measures[i].Unitx = unitx
 	}
 	return nil
 }
+
+// headerError create a parse error located on a header line
+func (p *SamplesParser) headerError(kind Line, msg string) *entity.ParseError {
+	return &entity.ParseError{File: entity.FileSamples, Line: p.lines[kind], Message: msg}
+}
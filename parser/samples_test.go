@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+var (
+	testStart = time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC)
+	testEnd   = time.Date(2019, time.January, 21, 15, 5, 0, 0, time.UTC)
+)
+
+// newTestParser create a samples parser of the csv format, its record being the one of benchFile
+func newTestParser(t *testing.T, reader io.Reader) *SamplesParser {
+	format, err := GetFormat("csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewSamplesParser(reader, format)
+	p.SetRecord(testStart, testEnd)
+	return p
+}
+
+func TestSamplesParserLongLines(t *testing.T) {
+	columns := 10000
+	row := "21,31:57.7" + strings.Repeat(",1011000", columns)
+	file := benchFile(",", columns, row, row)
+	if len(row) <= 64*1024 {
+		t.Fatalf("sample line of %d bytes, expected more than 64 KB", len(row))
+	}
+	p := newTestParser(t, strings.NewReader(file))
+
+	header, _, err := p.ParseHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.StartDate != "2019-01-21T14:31:00.000" || header.EndDate != "2019-01-21T15:05:00.000" {
+		t.Errorf("header %+v", header)
+	}
+	measures, size, err := p.ParseMeasures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(measures) != columns || size <= 64*1024 {
+		t.Fatalf("%d measures in %d bytes, expected %d in a header wider than 64 KB", len(measures), size, columns)
+	}
+
+	batch, end, err := p.ReadBatch(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !end || batch.Size() != 2*len(row) {
+		t.Fatalf("batch of %d bytes, end %v, expected the 2 rows up to the end", batch.Size(), end)
+	}
+	p.Convert(batch)
+	samples, err := p.Resolve(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2*columns {
+		t.Fatalf("%d samples, expected %d", len(samples), 2*columns)
+	}
+	last := samples[len(samples)-1]
+	sampleTime := time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC)
+	if last.Value != int64(1011000) || last.Inc != columns-1 || !last.Time.Equal(sampleTime) {
+		t.Errorf("last sample %+v", last)
+	}
+}
+
+// failingReader return the content then the error, as a connection dropped during an upload
+type failingReader struct {
+	content io.Reader
+	err     error
+}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	n, err := r.content.Read(b)
+	if err == io.EOF {
+		return n, r.err
+	}
+	return n, err
+}
+
+func TestSamplesParserReadError(t *testing.T) {
+	file := benchFile(",", 2, "21,31:57.7,1,2", "21,31:58.4,3,4")
+	failure := errors.New("connection reset")
+	tests := []struct {
+		name    string
+		content string
+		line    int
+	}{
+		{"in the header", file[:strings.Index(file, "Day in year")+5], 3},
+		{"in a sample line", file + "21,31:5", 9},
+		{"after a sample line", file, 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestParser(t, &failingReader{content: strings.NewReader(test.content), err: failure})
+
+			_, _, err := p.ParseHeader()
+			if err == nil {
+				_, _, err = p.ParseMeasures()
+			}
+			for err == nil {
+				var end bool
+				_, end, err = p.ReadBatch(1)
+				if end && err == nil {
+					t.Fatal("the file ended, expected the read error")
+				}
+			}
+			parseErr, ok := err.(*entity.ParseError)
+			if !ok {
+				t.Fatalf("error %v, expected a parse error", err)
+			}
+			if parseErr.File != entity.FileSamples || parseErr.Line != test.line || parseErr.Message != failure.Error() {
+				t.Errorf("error %+v, expected the read error on line %d", parseErr, test.line)
+			}
+		})
+	}
+}
@@ -1,28 +1,67 @@
 package parser
 
 import (
-	"bufio"
 	"errors"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	"github.com/leaklessgfy/safran-server/utils"
 )
 
-func parseLine(s *bufio.Scanner, skip int, limit int) ([]string, int, error) {
+// record is the time range of the recording, used to resolve and check the timestamps
+type record struct {
+	start time.Time
+	end   time.Time
+	last  time.Time
+}
+
+// resolve compute the absolute time of a day of year and a time, it must be inside the record range,
+// times without hour are resolved from the previous one so the stream can cross hours
+func (r *record) resolve(day, str string) (time.Time, error) {
+	ref := r.last
+	if ref.IsZero() {
+		ref = r.start
+	}
+	t, err := utils.ParseDayTime(day, str, ref)
+	if err != nil {
+		return t, err
+	}
+	if t.Before(r.start) || t.After(r.end) {
+		return t, errors.New(
+			"Time " + t.Format(time.RFC3339Nano) +
+				" outside of the record range " + r.start.Format(time.RFC3339Nano) +
+				" - " + r.end.Format(time.RFC3339Nano),
+		)
+	}
+	r.last = t
+	return t, nil
+}
+
+// readError return the error which stopped the reader, reaching the end of the file being one
+func readError(r *lineReader) error {
+	if r.Err() != nil {
+		return r.Err()
+	}
+	return &entity.ParseError{File: r.file, Line: r.Line() + 1, Message: "unexpected end of file"}
+}
+
+func parseLine(s *lineReader, sep string, skip int, limit int) ([]string, int, error) {
 	if !s.Scan() {
-		return nil, 0, errors.New("Error while reading")
+		return nil, 0, readError(s)
 	}
 	line := s.Text()
 	if len(line) < 1 {
-		return []string{}, 0, errors.New("Empty content")
+		return []string{}, 0, s.Error(0, "", "Empty content")
 	}
-	tmp := strings.Split(line, separator)
+	tmp := strings.Split(line, sep)
 	lgt := skip + limit
 	if len(tmp) < skip || len(tmp) < lgt {
-		return nil, 0, errors.New(
-			"Array index overflow, skip = " + strconv.Itoa(skip) +
-				", limit = " + strconv.Itoa(limit) +
-				", length = " + strconv.Itoa(len(tmp)) +
-				", line = " + line,
+		return nil, 0, s.Error(0, line,
+			"Array index overflow, skip = "+strconv.Itoa(skip)+
+				", limit = "+strconv.Itoa(limit)+
+				", length = "+strconv.Itoa(len(tmp)),
 		)
 	}
 	if limit < 1 {
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/leaklessgfy/safran-server/entity"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrTooManyImports is returned when the registry reached its concurrent imports cap
+var ErrTooManyImports = errors.New("too many imports in progress, retry later")
+
+// ErrAlreadyImporting is returned when an import of the experiment is already running
+var ErrAlreadyImporting = errors.New("experiment is already being imported")
+
+const (
+	historySize     = 1000
+	subscriberQueue = 50
+)
+
+// ErrNotStarted is returned when controlling an import not started yet
+var ErrNotStarted = errors.New("import not started")
+
+// Controller drive a running import
+type Controller interface {
+	Cancel() error
+	Pause() error
+	Resume() error
+}
+
+// Import is an import tracked by the registry, from the upload to the last report
+type Import struct {
+	Channel      string
+	experimentID string
+	mutex        sync.Mutex
+	snapshot     *entity.Report
+	history      []entity.Report
+	subscribers  map[chan entity.Report]struct{}
+	closers      []io.Closer
+	controller   Controller
+	created      time.Time
+	started      time.Time
+	reported     time.Time
+	finished     time.Time
+	evicting     bool
+}
+
+func newImport(channel, experimentID string) *Import {
+	return &Import{
+		Channel:      channel,
+		experimentID: experimentID,
+		snapshot:     entity.NewReport(channel),
+		subscribers:  make(map[chan entity.Report]struct{}),
+		created:      time.Now(),
+	}
+}
+
+// ImportStatus is the last known state of an import
+type ImportStatus struct {
+	Channel  string        `json:"channel"`
+	Created  time.Time     `json:"created"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+	Report   entity.Report `json:"report"`
+}
+
+// Status return a snapshot of the import state
+func (i *Import) Status() ImportStatus {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	status := ImportStatus{
+		Channel: i.Channel,
+		Created: i.created,
+		Report:  i.snapshot.Clone(),
+	}
+	if !i.started.IsZero() {
+		started := i.started
+		status.Started = &started
+	}
+	if !i.finished.IsZero() {
+		finished := i.finished
+		status.Finished = &finished
+	}
+	return status
+}
+
+// Update merge the report into the import snapshot without publishing it
+func (i *Import) Update(report entity.Report) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.snapshot.Merge(report)
+	i.reported = time.Now()
+}
+
+// Subscribe return the published reports with an ID greater than lastID,
+// and a channel receiving the next ones until unsubscribe is called or the import is removed
+func (i *Import) Subscribe(lastID int) ([]entity.Report, <-chan entity.Report, func()) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	var replay []entity.Report
+	for _, report := range i.history {
+		if report.ID > lastID {
+			replay = append(replay, report)
+		}
+	}
+
+	reports := make(chan entity.Report, subscriberQueue)
+	i.subscribers[reports] = struct{}{}
+
+	unsubscribe := func() {
+		i.mutex.Lock()
+		defer i.mutex.Unlock()
+		delete(i.subscribers, reports)
+	}
+	return replay, reports, unsubscribe
+}
+
+// Publish record a report in the history and push it to every subscriber
+func (i *Import) Publish(report entity.Report) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.snapshot.Merge(report)
+	i.reported = time.Now()
+	i.history = append(i.history, report)
+	if len(i.history) > historySize {
+		i.history = i.history[len(i.history)-historySize:]
+	}
+	for subscriber := range i.subscribers {
+		push(subscriber, report)
+	}
+	if report.Type == entity.TypeClient && report.HasComplete() {
+		i.finish()
+	}
+}
+
+// push send a report, dropping the oldest pending one if the subscriber is too slow
+func push(subscriber chan entity.Report, report entity.Report) {
+	for {
+		select {
+		case subscriber <- report:
+			return
+		default:
+		}
+		select {
+		case <-subscriber:
+		default:
+		}
+	}
+}
+
+// AddCloser register a resource to release once the import is over
+func (i *Import) AddCloser(closer io.Closer) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.closers = append(i.closers, closer)
+}
+
+// Start mark the import as started, driven by controller
+func (i *Import) Start(controller Controller) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.started = time.Now()
+	i.reported = i.started
+	i.controller = controller
+}
+
+// Cancel abort the import through its controller
+func (i *Import) Cancel() error {
+	return i.control(Controller.Cancel)
+}
+
+// Pause suspend the import through its controller
+func (i *Import) Pause() error {
+	return i.control(Controller.Pause)
+}
+
+// Resume restart the import through its controller
+func (i *Import) Resume() error {
+	return i.control(Controller.Resume)
+}
+
+func (i *Import) control(action func(Controller) error) error {
+	i.mutex.Lock()
+	controller := i.controller
+	i.mutex.Unlock()
+
+	if controller == nil {
+		return ErrNotStarted
+	}
+	return action(controller)
+}
+
+// Created return when the import was registered
+func (i *Import) Created() time.Time {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.created
+}
+
+// Started return when the import was started, zero if not started
+func (i *Import) Started() time.Time {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.started
+}
+
+// Finished return when the import was finished, zero if not finished
+func (i *Import) Finished() time.Time {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.finished
+}
+
+func (i *Import) finish() {
+	if i.finished.IsZero() {
+		i.finished = time.Now()
+	}
+	i.close()
+}
+
+func (i *Import) close() {
+	for _, closer := range i.closers {
+		err := closer.Close()
+		if err != nil {
+			log.Println("[ERROR CLOSE]", i.Channel, err)
+		}
+	}
+	i.closers = nil
+}
+
+// evict mark the import as being evicted, it returns false if it already was
+func (i *Import) evict() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.evicting {
+		return false
+	}
+	i.evicting = true
+	return true
+}
+
+func (i *Import) running() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.finished.IsZero()
+}
+
+// expired return true once the import is finished, not started or silent for longer than ttl
+func (i *Import) expired(now time.Time, ttl time.Duration) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if !i.finished.IsZero() {
+		return now.Sub(i.finished) > ttl
+	}
+	if i.started.IsZero() {
+		return now.Sub(i.created) > ttl
+	}
+	return now.Sub(i.reported) > ttl
+}
+
+// Registry keep track of the imports, safe for concurrent use
+type Registry struct {
+	mutex   sync.RWMutex
+	imports map[string]*Import
+	ttl     time.Duration
+	max     int
+}
+
+// NewRegistry create a registry evicting imports after ttl and accepting at most max running imports
+func NewRegistry(ttl time.Duration, max int) *Registry {
+	return &Registry{
+		imports: make(map[string]*Import),
+		ttl:     ttl,
+		max:     max,
+	}
+}
+
+// Create register a new import on a fresh channel, reserving the experiment until the import is over,
+// an empty experimentID reserving nothing
+func (r *Registry) Create(experimentID string) (*Import, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	running := 0
+	for _, i := range r.imports {
+		if !i.running() {
+			continue
+		}
+		if experimentID != "" && i.experimentID == experimentID {
+			return nil, ErrAlreadyImporting
+		}
+		running++
+	}
+	if r.max > 0 && running >= r.max {
+		return nil, ErrTooManyImports
+	}
+
+	i := newImport(uuid.NewV4().String(), experimentID)
+	r.imports[i.Channel] = i
+	return i, nil
+}
+
+// Get return the import registered on channel
+func (r *Registry) Get(channel string) (*Import, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	i, ok := r.imports[channel]
+	return i, ok
+}
+
+// List return the registered imports, oldest first
+func (r *Registry) List() []*Import {
+	r.mutex.RLock()
+	imports := make([]*Import, 0, len(r.imports))
+	for _, i := range r.imports {
+		imports = append(imports, i)
+	}
+	r.mutex.RUnlock()
+
+	sort.Slice(imports, func(a, b int) bool {
+		return imports[a].Created().Before(imports[b].Created())
+	})
+	return imports
+}
+
+// Remove unregister the import on channel and release its resources
+func (r *Registry) Remove(channel string) {
+	r.mutex.Lock()
+	i, ok := r.imports[channel]
+	delete(r.imports, channel)
+	r.mutex.Unlock()
+
+	if ok {
+		i.mutex.Lock()
+		i.close()
+		for subscriber := range i.subscribers {
+			close(subscriber)
+			delete(i.subscribers, subscriber)
+		}
+		i.mutex.Unlock()
+	}
+}
+
+// Evict remove the imports finished or abandoned for longer than the ttl,
+// the started imports which stopped reporting are cancelled before being removed
+func (r *Registry) Evict(now time.Time) int {
+	var expired []*Import
+
+	r.mutex.RLock()
+	for _, i := range r.imports {
+		if i.expired(now, r.ttl) {
+			expired = append(expired, i)
+		}
+	}
+	r.mutex.RUnlock()
+
+	n := 0
+	for _, i := range expired {
+		if !i.running() {
+			r.Remove(i.Channel)
+			n++
+			continue
+		}
+		if !i.evict() {
+			continue
+		}
+		n++
+		// the rollback of a stalled import may hang as well, it must not block the next evictions
+		go func(i *Import) {
+			err := i.Cancel()
+			if err != nil && err != ErrNotStarted {
+				log.Println("[ERROR EVICT]", i.Channel, err)
+			}
+			r.Remove(i.Channel)
+		}(i)
+	}
+	return n
+}
+
+// Watch evict the expired imports every interval, it never returns
+func (r *Registry) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if n := r.Evict(now); n > 0 {
+			log.Println("[EVICT]", n)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+const (
+	formatZip   = "zip"
+	formatTarGz = "tar.gz"
+)
+
+// resultHandler serve the files written by a file based output, archived when there are several
+func (s Server) resultHandler(w http.ResponseWriter, r *http.Request, channelID string) {
+	w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+
+	imp, ok := s.imports.Get(channelID)
+	if !ok {
+		http.Error(w, "Undefined channel "+channelID, http.StatusNotFound)
+		return
+	}
+
+	report := imp.Status().Report
+	if report.Status != entity.StatusSuccess {
+		http.Error(w, "Import not successfully finished", http.StatusConflict)
+		return
+	}
+	root := filepath.Join(s.config.Output.Dir, report.ExperimentID)
+	files, err := resultFiles(root, report.Files)
+	if err != nil {
+		http.Error(w, "Result file unavailable", http.StatusGone)
+		return
+	}
+	if len(files) < 1 {
+		http.Error(w, "No result file for this output", http.StatusNotFound)
+		return
+	}
+
+	if len(files) == 1 {
+		serveFile(w, r, files[0])
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatZip
+	}
+	err = serveArchive(w, root, report.ExperimentID+"."+format, format, files)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// resultFiles return the paths of the report files in root, the directories being replaced by their files
+func resultFiles(root string, names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		err := filepath.Walk(filepath.Join(root, name), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func serveFile(w http.ResponseWriter, r *http.Request, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		http.Error(w, "Result file unavailable", http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := filepath.Base(path)
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+}
+
+// serveArchive stream the files in an archive, named relatively to root
+func serveArchive(w http.ResponseWriter, root, name, format string, files []string) error {
+	var contentType string
+	switch format {
+	case formatZip:
+		contentType = "application/zip"
+	case formatTarGz:
+		contentType = "application/gzip"
+	default:
+		return errors.New("Unsupported archive format " + format)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+	var err error
+	if format == formatZip {
+		err = writeZip(w, root, files)
+	} else {
+		err = writeTarGz(w, root, files)
+	}
+	if err != nil {
+		// headers are already sent, the truncated archive is the only signal left to the client
+		log.Println("[ERROR ARCHIVE]", name, err)
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, root string, files []string) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		name, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		entry, err := archive.Create(filepath.ToSlash(name))
+		if err != nil {
+			return err
+		}
+		err = copyFile(entry, file)
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeTarGz(w io.Writer, root string, files []string) error {
+	compressor := gzip.NewWriter(w)
+	archive := tar.NewWriter(compressor)
+	for _, file := range files {
+		name, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(stat, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		err = archive.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		err = copyFile(archive, file)
+		if err != nil {
+			return err
+		}
+	}
+	err := archive.Close()
+	if err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -4,48 +4,89 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/leaklessgfy/safran-server/config"
 	"github.com/leaklessgfy/safran-server/observer"
 
 	"github.com/leaklessgfy/safran-server/entity"
 	"github.com/leaklessgfy/safran-server/facade"
-	uuid "github.com/satori/go.uuid"
+	"github.com/leaklessgfy/safran-server/journal"
+	"github.com/leaklessgfy/safran-server/parser"
 
 	"github.com/leaklessgfy/safran-server/service"
 )
 
+const evictInterval = time.Minute
+
 // Server is an abstraction layer for http server
 type Server struct {
-	imports map[string]chan entity.Report
+	config  *config.Config
+	options facade.Options
+	imports *Registry
+	journal *journal.Journal
 }
 
 // NewServer create a server instance
-func NewServer() *Server {
-	imports := make(map[string]chan entity.Report)
-	imports["TEST"] = make(chan entity.Report, 2)
+func NewServer(conf *config.Config) (*Server, error) {
+	options := facade.DefaultOptions()
+	dates, err := conf.Dates.Format()
+	if err != nil {
+		return nil, err
+	}
+	options.Dates = dates
+	options.Policy = parser.Policy(conf.Errors.Policy)
+	options.MaxErrors = conf.Errors.Max
+	options.RejectsDir = conf.Output.Dir
+	if conf.Imports.Workers > 0 {
+		options.Workers = conf.Imports.Workers
+	}
+	journal, err := journal.NewJournal(conf.Imports.Journal)
+	if err != nil {
+		return nil, err
+	}
 
 	return &Server{
-		imports: imports,
-	}
+		config:  conf,
+		options: options,
+		imports: NewRegistry(conf.Imports.TTL.Duration, conf.Imports.Max),
+		journal: journal,
+	}, nil
 }
 
 // Start will start the http server and setup routes
-func (s Server) Start(port string) error {
+func (s Server) Start() error {
 	http.HandleFunc("/simple", s.simpleHandler)
 	http.HandleFunc("/upload", s.uploadHandler)
 	http.HandleFunc("/events", s.eventsHandler)
+	http.HandleFunc("/ws", s.socketHandler)
+	http.HandleFunc("/imports", s.importsHandler)
+	http.HandleFunc("/imports/", s.importsHandler)
 
-	return http.ListenAndServe(port, nil)
+	go s.imports.Watch(evictInterval)
+
+	return http.ListenAndServe(s.config.Addr, nil)
 }
 
 func (s Server) simpleHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	select {
-	case s.imports["TEST"] <- *entity.NewReport("TEST"):
-		w.WriteHeader(200)
-	default:
-		http.Error(w, "no consumer", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+
+	imp, err := s.imports.Create("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
 	}
+	imp.Start(nil)
+
+	report := entity.NewReport(imp.Channel).Copy(entity.TypeClient)
+	report.Steps[entity.StepInit] = true
+	report.AddSuccess(entity.StepFullEnd).End()
+	imp.Publish(*report)
+
+	json.NewEncoder(w).Encode(report)
 }
 
 func (s Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,21 +94,38 @@ func (s Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	r.ParseMultipartForm(32 << 20)
 
-	channelUUID := uuid.NewV4()
-	channelID := channelUUID.String()
 	jsonR := json.NewEncoder(w)
-	report := entity.NewReport(channelID)
 
 	// EXPERIMENT
 	experiment, err := service.ExtractExperiment(r)
 	if err != nil {
-		jsonR.Encode(report.AddError(entity.StepExtractExperiment, err))
+		jsonR.Encode(entity.NewReport("").AddError(entity.StepExtractExperiment, err))
+		return
+	}
+	experiment.ID = experiment.Key()
+
+	// the experiment is reserved with the import, a concurrent upload of it is refused
+	imp, err := s.imports.Create(experiment.ID)
+	if err == ErrAlreadyImporting {
+		w.WriteHeader(http.StatusConflict)
+		jsonR.Encode(entity.NewReport("").AddError(entity.StepInit, err))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusTooManyRequests)
+		jsonR.Encode(entity.NewReport("").AddError(entity.StepInit, err))
 		return
 	}
+	defer func() {
+		if imp.Started().IsZero() {
+			s.imports.Remove(imp.Channel)
+		}
+	}()
+	report := entity.NewReport(imp.Channel)
 	report.AddSuccess(entity.StepExtractExperiment)
 
 	// OUTPUT
-	output, err := service.ExtractOutput(r)
+	output, err := service.ExtractOutput(r, s.config)
 	if err != nil {
 		jsonR.Encode(report.AddError(entity.StepExtractSaver, err))
 		return
@@ -80,9 +138,22 @@ func (s Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		jsonR.Encode(report.AddError(entity.StepExtractSamples, err))
 		return
 	}
+	imp.AddCloser(samplesFile)
+
+	hash, err := service.ExtractHash(samplesFile)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepExtractSamples, err))
+		return
+	}
+	options := s.options
+	format, samplesReader, err := service.ExtractFormat(r, samplesFile)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepExtractSamples, err))
+		return
+	}
+	options.Format = format
 	report.SamplesSize = samplesSize
 	report.AddSuccess(entity.StepExtractSamples)
-	defer samplesFile.Close()
 
 	alarmsFile, alarmsSize, err := service.ExtractAlarms(r)
 	if err != nil {
@@ -93,26 +164,89 @@ func (s Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
 		report.HasAlarms = true
 		report.AlarmsSize = alarmsSize
 		report.AddSuccess(entity.StepExtractAlarms)
-		defer alarmsFile.Close()
+		imp.AddCloser(alarmsFile)
 	}
 
 	// IMPORT
-	observer := observer.LoggerObserver{}
-	facade := facade.NewParserFacade(output, observer, samplesFile, alarmsFile)
+	outputKey := r.FormValue("output")
+	mode, err := service.ExtractMode(r)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepInitImport, err))
+		return
+	}
+	record, found, err := s.journal.Get(outputKey, experiment.ID)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepInitImport, err))
+		return
+	}
+	done, err := service.ResumeImport(mode, record, found, hash, output, &options)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepInitImport, err))
+		return
+	}
+	if done {
+		// the same file was already imported, nothing is saved again
+		imp.Start(nil)
+		report.ExperimentID = experiment.ID
+		report = report.Copy(entity.TypeClient)
+		report.AddSuccess(entity.StepSkip).End()
+		imp.Publish(*report)
+		jsonR.Encode(report)
+		return
+	}
+	options.Policy, options.MaxErrors, err = service.ExtractPolicy(r, options.Policy, options.MaxErrors)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepInitImport, err))
+		return
+	}
+	batch, err := service.ExtractBatch(r, s.config)
+	if err != nil {
+		jsonR.Encode(report.AddError(entity.StepInitImport, err))
+		return
+	}
+	options.Lines = batch.Lines
+	options.Flush = facade.Flush{Samples: batch.Samples, Bytes: batch.Bytes, Interval: batch.Interval.Duration}
+	var previous *journal.Record
+	if found && (options.Append || options.Resume != nil) {
+		previous = &record
+	}
+	observer := observer.NewCompositeObserver(
+		observer.LoggerObserver{},
+		observer.NewReportObserver(*report, imp),
+		observer.NewJournalObserver(s.journal, journalRecord(experiment, outputKey, hash, options.Resume), previous),
+	)
+	facade := facade.NewParserFacade(output, observer, samplesReader, alarmsFile, options)
 
 	err = facade.Parse(experiment)
 	if err != nil {
 		jsonR.Encode(report.AddError(entity.StepInitImport, err))
 		return
 	}
+	imp.Start(facade)
 	report.AddSuccess(entity.StepInitImport)
-
-	channel := make(chan entity.Report, 50)
-	s.imports[channelID] = channel
+	report.ExperimentID = experiment.ID
+	imp.Update(*report)
 
 	jsonR.Encode(report)
 }
 
+// journalRecord return the record of an import, counting what the crashed import saved when resuming it
+func journalRecord(experiment *entity.Experiment, output, hash string, resume *facade.Resume) journal.Record {
+	record := journal.Record{
+		ExperimentID: experiment.ID,
+		Reference:    experiment.Reference,
+		Bench:        experiment.Bench,
+		Campaign:     experiment.Campaign,
+		Output:       output,
+		Hash:         hash,
+	}
+	if resume != nil {
+		record.Samples = resume.Samples
+		record.Alarms = resume.Alarms
+	}
+	return record
+}
+
 func (s Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
@@ -123,7 +257,7 @@ func (s Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	channelID := r.URL.Query().Get("channel")
-	channel, ok := s.imports[channelID]
+	imp, ok := s.imports.Get(channelID)
 	if !ok {
 		http.Error(w, "Undefined channel "+channelID, http.StatusNotFound)
 		return
@@ -133,21 +267,107 @@ func (s Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID, _ := strconv.Atoi(lastEventID)
+
+	replay, reports, unsubscribe := imp.Subscribe(lastID)
+	defer unsubscribe()
+
+	for _, report := range replay {
+		if writeEvent(w, flusher, report) {
+			return
+		}
+	}
+
 	for {
 		select {
 		case <-r.Context().Done():
 			return
-		case report := <-channel:
-			fmt.Fprintf(w, "id: %d\n", report.ID)
-			fmt.Fprintf(w, "event: %s\n", report.Type)
-			fmt.Fprintf(w, "data: %s\n\n", report.ToJSON())
-			flusher.Flush()
-
-			if report.HasComplete() && report.Type == entity.TypeClient {
-				close(channel)
-				delete(s.imports, channelID)
+		case report, ok := <-reports:
+			if !ok || writeEvent(w, flusher, report) {
 				return
 			}
 		}
 	}
 }
+
+// writeEvent send the report as a server-sent event, it returns true on the final report
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, report entity.Report) bool {
+	fmt.Fprintf(w, "id: %d\n", report.ID)
+	fmt.Fprintf(w, "event: %s\n", report.Type)
+	fmt.Fprintf(w, "data: %s\n\n", report.ToJSON())
+	flusher.Flush()
+
+	return report.HasComplete() && report.Type == entity.TypeClient
+}
+
+func (s Server) importsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, OPTIONS")
+
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/imports"), "/"), "/")
+	channelID := path[0]
+	if len(path) > 2 || (len(path) == 2 && path[1] != "result") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		if channelID == "" {
+			s.listHandler(w, r)
+			return
+		}
+		if len(path) == 2 {
+			s.resultHandler(w, r, channelID)
+			return
+		}
+		s.statusHandler(w, r, channelID)
+	case http.MethodDelete:
+		s.cancelHandler(w, r, channelID)
+	default:
+		http.Error(w, "Method not allowed "+r.Method, http.StatusMethodNotAllowed)
+	}
+}
+
+func (s Server) listHandler(w http.ResponseWriter, r *http.Request) {
+	imports := s.imports.List()
+	statuses := make([]ImportStatus, 0, len(imports))
+	for _, imp := range imports {
+		statuses = append(statuses, imp.Status())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+func (s Server) statusHandler(w http.ResponseWriter, r *http.Request, channelID string) {
+	imp, ok := s.imports.Get(channelID)
+	if !ok {
+		http.Error(w, "Undefined channel "+channelID, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(imp.Status())
+}
+
+func (s Server) cancelHandler(w http.ResponseWriter, r *http.Request, channelID string) {
+	imp, ok := s.imports.Get(channelID)
+	if !ok {
+		http.Error(w, "Undefined channel "+channelID, http.StatusNotFound)
+		return
+	}
+
+	err := imp.Cancel()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
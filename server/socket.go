@@ -0,0 +1,134 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	"github.com/leaklessgfy/safran-server/entity"
+)
+
+const (
+	actionCancel = "cancel"
+	actionPause  = "pause"
+	actionResume = "resume"
+
+	typeControl = "Control"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// control is a message sent by the client to drive the import
+type control struct {
+	Action string `json:"action"`
+}
+
+// controlAck is the answer to a control message
+type controlAck struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s Server) socketHandler(w http.ResponseWriter, r *http.Request) {
+	channelID := r.URL.Query().Get("channel")
+	imp, ok := s.imports.Get(channelID)
+	if !ok {
+		http.Error(w, "Undefined channel "+channelID, http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	lastID, _ := strconv.Atoi(r.URL.Query().Get("lastEventId"))
+	replay, reports, unsubscribe := imp.Subscribe(lastID)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	defer close(done)
+	acks := make(chan controlAck)
+	closed := make(chan struct{})
+	go readControls(conn, imp, acks, closed, done)
+
+	for _, report := range replay {
+		if writeReport(conn, report) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-closed:
+			return
+		case ack := <-acks:
+			if conn.WriteJSON(ack) != nil {
+				return
+			}
+		case report, ok := <-reports:
+			if !ok || writeReport(conn, report) {
+				return
+			}
+		}
+	}
+}
+
+// writeReport send the report as a JSON message, it returns true on the final report or a broken connection
+func writeReport(conn *websocket.Conn, report entity.Report) bool {
+	err := conn.WriteJSON(report)
+	if err != nil {
+		return true
+	}
+	if report.HasComplete() && report.Type == entity.TypeClient {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		return true
+	}
+	return false
+}
+
+// readControls apply the control messages of the client until the connection is closed
+func readControls(conn *websocket.Conn, imp *Import, acks chan<- controlAck, closed chan<- struct{}, done <-chan struct{}) {
+	defer close(closed)
+
+	for {
+		var message control
+		err := conn.ReadJSON(&message)
+		if err != nil {
+			return
+		}
+
+		ack := controlAck{Type: typeControl, Action: message.Action, Status: entity.StatusSuccess}
+		err = applyControl(imp, message.Action)
+		if err != nil {
+			ack.Status = entity.StatusFailure
+			ack.Error = err.Error()
+		}
+
+		select {
+		case acks <- ack:
+		case <-done:
+			return
+		}
+	}
+}
+
+func applyControl(imp *Import, action string) error {
+	switch action {
+	case actionCancel:
+		return imp.Cancel()
+	case actionPause:
+		return imp.Pause()
+	case actionResume:
+		return imp.Resume()
+	}
+	return errors.New("unknown action " + action)
+}
@@ -3,12 +3,17 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/leaklessgfy/safran-server/config"
 	"github.com/leaklessgfy/safran-server/entity"
 	"github.com/leaklessgfy/safran-server/output"
+	"github.com/leaklessgfy/safran-server/parser"
 )
 
 type Sizer interface {
@@ -32,12 +37,79 @@ func ExtractExperiment(r *http.Request) (*entity.Experiment, error) {
 	return &experiment, nil
 }
 
-func ExtractOutput(r *http.Request) (output.Output, error) {
+func ExtractOutput(r *http.Request, conf *config.Config) (output.Output, error) {
 	key := r.FormValue("output")
 	if key == "" {
 		return nil, errors.New("output info is required")
 	}
-	return output.NewOutput(key)
+	return output.NewOutput(key, conf)
+}
+
+// ExtractFormat return the samples format picked by the format field, or detected from the file when empty,
+// the returned reader must be parsed in place of the samples file
+func ExtractFormat(r *http.Request, samples io.Reader) (parser.Format, io.Reader, error) {
+	key := r.FormValue("format")
+	if key == "" {
+		return parser.DetectFormat(samples)
+	}
+	format, err := parser.GetFormat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return format, samples, nil
+}
+
+// ExtractPolicy return the error policy and max errors of the form, the defaults being used when absent
+func ExtractPolicy(r *http.Request, policy parser.Policy, max int) (parser.Policy, int, error) {
+	var err error
+	if key := r.FormValue("errors"); key != "" {
+		policy, err = parser.ParsePolicy(key)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	if value := r.FormValue("maxErrors"); value != "" {
+		max, err = strconv.Atoi(value)
+		if err != nil {
+			return "", 0, errors.New("invalid maxErrors " + value)
+		}
+	}
+	return policy, max, nil
+}
+
+// ExtractBatch return the batch configuration of the output, overridden by the batch fields of the form
+func ExtractBatch(r *http.Request, conf *config.Config) (config.BatchConfig, error) {
+	batch := conf.BatchFor(r.FormValue("output"))
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"batchLines", &batch.Lines},
+		{"batchSamples", &batch.Samples},
+		{"batchBytes", &batch.Bytes},
+	}
+	for _, field := range fields {
+		value := r.FormValue(field.name)
+		if value == "" {
+			continue
+		}
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 {
+			return batch, errors.New("invalid " + field.name + " " + value)
+		}
+		*field.value = i
+	}
+	if value := r.FormValue("batchInterval"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return batch, errors.New("invalid batchInterval " + value)
+		}
+		batch.Interval.Duration = d
+	}
+	if batch.Lines < 1 {
+		return batch, errors.New("batchLines should be positive")
+	}
+	return batch, nil
 }
 
 func ExtractSamples(r *http.Request) (multipart.File, int64, error) {
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/leaklessgfy/safran-server/facade"
+	"github.com/leaklessgfy/safran-server/journal"
+	"github.com/leaklessgfy/safran-server/output"
+)
+
+// Modes of an upload of an experiment already imported in the output
+const (
+	ModeSkip    = "skip"
+	ModeReplace = "replace"
+	ModeAppend  = "append"
+)
+
+// ErrAlreadyImported is returned when the experiment was imported in the output from another file
+var ErrAlreadyImported = errors.New("experiment already imported from another file, use the replace or append mode")
+
+// ExtractHash return the sha256 of the file, rewinding it to be parsed afterwards
+func ExtractHash(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ExtractMode return the mode field of the form, skip by default
+func ExtractMode(r *http.Request) (string, error) {
+	mode := r.FormValue("mode")
+	switch mode {
+	case "":
+		return ModeSkip, nil
+	case ModeSkip, ModeReplace, ModeAppend:
+		return mode, nil
+	}
+	return "", errors.New("invalid mode " + mode + ", expected " + ModeSkip + ", " + ModeReplace + " or " + ModeAppend)
+}
+
+// ResumeImport set the options of the upload from its mode and the journal record of the experiment,
+// it returns true when the same file was already fully imported and there is nothing to do
+func ResumeImport(mode string, record journal.Record, found bool, hash string, out output.Output, options *facade.Options) (bool, error) {
+	switch mode {
+	case ModeReplace:
+		options.Replace = true
+		return false, nil
+	case ModeAppend:
+		options.Append = true
+		return false, nil
+	}
+	if !found {
+		return false, nil
+	}
+	if record.Hash != hash {
+		return false, ErrAlreadyImported
+	}
+	if record.Status == journal.StatusDone {
+		return true, nil
+	}
+	// the previous import of the file crashed, continue it when the output can append to the experiment
+	if _, ok := out.(output.AppendOutput); ok {
+		options.Resume = &facade.Resume{Samples: record.Samples, Alarms: record.Alarms}
+	} else {
+		options.Replace = true
+	}
+	return false, nil
+}
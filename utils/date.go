@@ -7,60 +7,175 @@ import (
 	"time"
 )
 
-// ParseDate parse a date representation (ex: ) to Time struct
-func ParseDate(str string) (time.Time, error) {
-	t, err := time.Parse("2006-01-02T15:04:05.000", str)
+// DefaultDateLayout is the layout of the header dates (ex: 2019-01-21T14:31:00.000)
+const DefaultDateLayout = "2006-01-02T15:04:05.000"
+
+// DateFormat describe how the header dates are written
+type DateFormat struct {
+	Layouts  []string
+	Location *time.Location
+}
+
+// DefaultDateFormat is the header dates format of the bench exports
+var DefaultDateFormat = DateFormat{Layouts: []string{DefaultDateLayout}, Location: time.UTC}
+
+// NewDateFormat create a date format trying layouts in order, in the location named zone (ex: Europe/Paris)
+func NewDateFormat(layouts []string, zone string) (DateFormat, error) {
+	if len(layouts) < 1 {
+		layouts = DefaultDateFormat.Layouts
+	}
+	location, err := time.LoadLocation(zone)
 	if err != nil {
-		return t, err
+		return DateFormat{}, err
 	}
-	return t.UTC(), nil
+	return DateFormat{Layouts: layouts, Location: location}, nil
 }
 
-// ParseTime parse a time representation (ex: 12:03:00 or 12:04:05.555) to Time struct
-func ParseTime(str string, date time.Time) (time.Time, error) {
+// Parse parse a date with the first matching layout
+func (f DateFormat) Parse(str string) (time.Time, error) {
+	location := f.Location
+	if location == nil {
+		location = time.UTC
+	}
 	var err error
-	hour := date.Hour()
-	min := date.Minute()
-	sec := date.Second()
-	nano := date.Nanosecond()
-
-	strSplit := strings.FieldsFunc(str, func(r rune) bool {
-		return r == ':' || r == '.' || r == ','
-	})
-
-	if len(strSplit) == 3 {
-		min, err = strconv.Atoi(strSplit[0])
-		if err != nil {
-			return date, err
-		}
-		sec, err = strconv.Atoi(strSplit[1])
-		if err != nil {
-			return date, err
-		}
-		nano, err = strconv.Atoi(strSplit[2])
-		if err != nil {
-			return date, err
+	for _, layout := range f.Layouts {
+		var t time.Time
+		t, err = time.ParseInLocation(layout, strings.TrimSpace(str), location)
+		if err == nil {
+			return t, nil
 		}
-	} else if len(strSplit) == 4 {
-		hour, err = strconv.Atoi(strSplit[0])
-		if err != nil {
-			return date, err
-		}
-		min, err = strconv.Atoi(strSplit[1])
-		if err != nil {
-			return date, err
+	}
+	if err == nil {
+		err = errors.New("Bad date formatting " + str + ", no layout")
+	}
+	return time.Time{}, err
+}
+
+// ParseDate parse a date representation (ex: 2019-01-21T14:31:00.000) to Time struct
+func ParseDate(str string) (time.Time, error) {
+	return DefaultDateFormat.Parse(str)
+}
+
+// Clock is a time of day, Hour is -1 when the representation has no hour (ex: 04:05.555)
+type Clock struct {
+	Hour int
+	Min  int
+	Sec  int
+	Nsec int
+}
+
+// ParseClock parse a time of day representation (ex: 12:04:05, 12:04:05.555 or 04:05,5),
+// the fraction is scaled by its digit count: .5 is 500ms, .555 is 555ms, .000555 is 555µs
+func ParseClock(str string) (Clock, error) {
+	clock := Clock{Hour: -1}
+	str = strings.TrimSpace(str)
+
+	fraction := ""
+	if i := strings.IndexAny(str, ".,"); i >= 0 {
+		fraction = str[i+1:]
+		str = str[:i]
+	}
+
+	parts := strings.Split(str, ":")
+	var values []int
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return clock, errors.New("Bad time formatting " + str)
 		}
-		sec, err = strconv.Atoi(strSplit[2])
-		if err != nil {
-			return date, err
+		values = append(values, value)
+	}
+
+	switch len(values) {
+	case 2:
+		clock.Min, clock.Sec = values[0], values[1]
+	case 3:
+		clock.Hour, clock.Min, clock.Sec = values[0], values[1], values[2]
+		if clock.Hour > 23 {
+			return clock, errors.New("Bad hour in time " + str)
 		}
-		nano, err = strconv.Atoi(strSplit[3])
-		if err != nil {
-			return date, err
+	default:
+		return clock, errors.New("Bad time formatting " + str)
+	}
+	if clock.Min > 59 || clock.Sec > 60 {
+		return clock, errors.New("Bad minutes or seconds in time " + str)
+	}
+
+	nsec, err := parseFraction(fraction)
+	if err != nil {
+		return clock, errors.New("Bad fraction in time " + str + "." + fraction)
+	}
+	clock.Nsec = nsec
+	return clock, nil
+}
+
+// On return the clock time on the day of date, in its location,
+// without hour it is the nearest time to ref on that day
+func (c Clock) On(date, ref time.Time) time.Time {
+	year, month, day := date.Date()
+	if c.Hour >= 0 {
+		return time.Date(year, month, day, c.Hour, c.Min, c.Sec, c.Nsec, date.Location())
+	}
+	var nearest time.Time
+	for hour := 0; hour < 24; hour++ {
+		t := time.Date(year, month, day, hour, c.Min, c.Sec, c.Nsec, date.Location())
+		if nearest.IsZero() || abs(t.Sub(ref)) < abs(nearest.Sub(ref)) {
+			nearest = t
 		}
-	} else {
-		return date, errors.New("Bad time formatting " + str)
 	}
+	return nearest
+}
+
+// ParseDayTime parse a day of year (ex: 021) and a time representation (ex: 14:04:05.555) to Time struct,
+// the year is the one of ref, or the next one when the day is before the ref day,
+// a time without hour is resolved to the nearest one from ref
+func ParseDayTime(day, str string, ref time.Time) (time.Time, error) {
+	yday, err := strconv.Atoi(strings.TrimSpace(day))
+	if err != nil || yday < 1 || yday > 366 {
+		return ref, errors.New("Bad day of year formatting " + day)
+	}
+	clock, err := ParseClock(str)
+	if err != nil {
+		return ref, err
+	}
+	year := ref.Year()
+	if yday < ref.YearDay() {
+		year++
+	}
+	date := time.Date(year, time.January, 1, 0, 0, 0, 0, ref.Location()).AddDate(0, 0, yday-1)
+	return clock.On(date, ref), nil
+}
 
-	return time.Date(date.Year(), date.Month(), date.Day(), hour, min, sec, nano, time.UTC).UTC(), nil
+// ParseTime parse a time representation (ex: 12:03:00 or 12:04:05.555) to Time struct on the day of date,
+// a time without hour (ex: 04:05.555) is resolved to the nearest one from date
+func ParseTime(str string, date time.Time) (time.Time, error) {
+	clock, err := ParseClock(str)
+	if err != nil {
+		return date, err
+	}
+	return clock.On(date, date), nil
+}
+
+func parseFraction(fraction string) (int, error) {
+	if fraction == "" {
+		return 0, nil
+	}
+	if len(fraction) > 9 {
+		fraction = fraction[:9]
+	}
+	nsec, err := strconv.Atoi(fraction)
+	if err != nil || nsec < 0 {
+		return 0, errors.New("Bad fraction " + fraction)
+	}
+	for i := len(fraction); i < 9; i++ {
+		nsec *= 10
+	}
+	return nsec, nil
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
 }
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// the samples of the tests come from the bench exports in csv/, testfile.csv and event.csv
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		name  string
+		str   string
+		clock Clock
+		err   bool
+	}{
+		{"samples time without hour", "31:57,7", Clock{Hour: -1, Min: 31, Sec: 57, Nsec: 700000000}, false},
+		{"samples time without fraction", "32:00", Clock{Hour: -1, Min: 32, Sec: 0}, false},
+		{"alarms time", "14:32:01.397", Clock{Hour: 14, Min: 32, Sec: 1, Nsec: 397000000}, false},
+		{"header time", "15:05:00.000", Clock{Hour: 15, Min: 5, Sec: 0}, false},
+		{"microseconds", "14:31:57.000555", Clock{Hour: 14, Min: 31, Sec: 57, Nsec: 555000}, false},
+		{"fraction beyond nanoseconds", "14:31:57.1234567891", Clock{Hour: 14, Min: 31, Sec: 57, Nsec: 123456789}, false},
+		{"surrounding spaces", " 31:58,4 ", Clock{Hour: -1, Min: 31, Sec: 58, Nsec: 400000000}, false},
+		{"leap second", "23:59:60", Clock{Hour: 23, Min: 59, Sec: 60}, false},
+		{"empty", "", Clock{}, true},
+		{"seconds only", "57", Clock{}, true},
+		{"too many parts", "1:14:31:57", Clock{}, true},
+		{"bad hour", "24:00:00", Clock{}, true},
+		{"bad minutes", "14:60:00", Clock{}, true},
+		{"bad seconds", "14:31:61", Clock{}, true},
+		{"negative", "-1:31:57", Clock{}, true},
+		{"letters", "14:3a:57", Clock{}, true},
+		{"bad fraction", "31:57,7a", Clock{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock, err := ParseClock(test.str)
+			if test.err {
+				if err == nil {
+					t.Fatalf("ParseClock(%q) = %+v, expected an error", test.str, clock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseClock(%q) failed: %v", test.str, err)
+			}
+			if clock != test.clock {
+				t.Errorf("ParseClock(%q) = %+v, expected %+v", test.str, clock, test.clock)
+			}
+		})
+	}
+}
+
+func TestParseDayTime(t *testing.T) {
+	start := time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		day  string
+		str  string
+		ref  time.Time
+		time time.Time
+		err  bool
+	}{
+		{"first sample", "21", "31:57,7", start, time.Date(2019, time.January, 21, 14, 31, 57, 700000000, time.UTC), false},
+		{"sample without hour in the next hour", "21", "32:00", time.Date(2019, time.January, 21, 15, 10, 0, 0, time.UTC), time.Date(2019, time.January, 21, 15, 32, 0, 0, time.UTC), false},
+		{"sample before ref in the hour", "21", "04:59,9", time.Date(2019, time.January, 21, 15, 4, 59, 0, time.UTC), time.Date(2019, time.January, 21, 15, 4, 59, 900000000, time.UTC), false},
+		{"alarm", "021", "14:32:01.397", start, time.Date(2019, time.January, 21, 14, 32, 1, 397000000, time.UTC), false},
+		{"last alarm", "021", "15:03:00.921", start, time.Date(2019, time.January, 21, 15, 3, 0, 921000000, time.UTC), false},
+		{"padded day", " 021 ", "14:34:13.333", start, time.Date(2019, time.January, 21, 14, 34, 13, 333000000, time.UTC), false},
+		{"next day", "22", "00:00:01", start, time.Date(2019, time.January, 22, 0, 0, 1, 0, time.UTC), false},
+		{"day before ref is next year", "001", "00:10:00", time.Date(2018, time.December, 31, 23, 50, 0, 0, time.UTC), time.Date(2019, time.January, 1, 0, 10, 0, 0, time.UTC), false},
+		{"leap year last day", "366", "12:00:00", time.Date(2020, time.December, 30, 0, 0, 0, 0, time.UTC), time.Date(2020, time.December, 31, 12, 0, 0, 0, time.UTC), false},
+		{"day zero", "0", "14:31:57", start, time.Time{}, true},
+		{"day beyond the year", "367", "14:31:57", start, time.Time{}, true},
+		{"day not a number", "2l", "14:31:57", start, time.Time{}, true},
+		{"bad time", "21", "31-57", start, time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseDayTime(test.day, test.str, test.ref)
+			if test.err {
+				if err == nil {
+					t.Fatalf("ParseDayTime(%q, %q) = %v, expected an error", test.day, test.str, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDayTime(%q, %q) failed: %v", test.day, test.str, err)
+			}
+			if !got.Equal(test.time) {
+				t.Errorf("ParseDayTime(%q, %q) = %v, expected %v", test.day, test.str, got, test.time)
+			}
+		})
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	tests := []struct {
+		name    string
+		layouts []string
+		zone    string
+		str     string
+		time    time.Time
+		err     bool
+	}{
+		{"record start", nil, "UTC", "2019-01-21T14:31:00.000", time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC), false},
+		{"record end", nil, "UTC", "2019-01-21T15:05:00.000", time.Date(2019, time.January, 21, 15, 5, 0, 0, time.UTC), false},
+		{"surrounding spaces", nil, "UTC", " 2019-01-21T14:31:00.000 ", time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC), false},
+		{"time zone", nil, "Europe/Paris", "2019-01-21T14:31:00.000", time.Date(2019, time.January, 21, 14, 31, 0, 0, paris), false},
+		{"summer time", nil, "Europe/Paris", "2019-07-21T14:31:00.000", time.Date(2019, time.July, 21, 12, 31, 0, 0, time.UTC), false},
+		{"second layout", []string{DefaultDateLayout, "02/01/2006 15:04:05"}, "UTC", "21/01/2019 14:31:00", time.Date(2019, time.January, 21, 14, 31, 0, 0, time.UTC), false},
+		{"no matching layout", nil, "UTC", "21/01/2019 14:31:00", time.Time{}, true},
+		{"empty", nil, "UTC", "", time.Time{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, err := NewDateFormat(test.layouts, test.zone)
+			if err != nil {
+				t.Fatalf("NewDateFormat(%v, %q) failed: %v", test.layouts, test.zone, err)
+			}
+			got, err := format.Parse(test.str)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, expected an error", test.str, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", test.str, err)
+			}
+			if !got.Equal(test.time) {
+				t.Errorf("Parse(%q) = %v, expected %v", test.str, got, test.time)
+			}
+		})
+	}
+}
+
+func TestNewDateFormatUnknownZone(t *testing.T) {
+	_, err := NewDateFormat(nil, "Europe/Nowhere")
+	if err == nil {
+		t.Fatal("NewDateFormat with an unknown zone, expected an error")
+	}
+}